@@ -64,11 +64,23 @@ const (
 	// Parameter parsing.
 	CMD_STACK_DEPLOY_PARAM_ONLY = "param-only"
 
+	// Command line flag for writing change sets to a plan file
+	CMD_STACK_DEPLOY_PLAN_OUT = "plan-out"
+
 	// Variable override
 	CMD_STACK_DEPLOY_VARS = "vars"
 
-	// Default environment folder name.
-	STACK_DEPLOY_ENV_DEFAULT_FOLDER = "default"
+	// Single variable override, repeatable
+	CMD_STACK_DEPLOY_VAR = "var"
+
+	// Variable override file, repeatable
+	CMD_STACK_DEPLOY_VAR_FILE = "var-file"
+
+	// Add the stacks selected stacks depend on
+	CMD_STACK_DEPLOY_WITH_DEPENDENCIES = "with-dependencies"
+
+	// Add the stacks depending on selected stacks
+	CMD_STACK_DEPLOY_WITH_DEPENDENTS = "with-dependents"
 
 	// Command line flag for stack delete all.
 	CMD_STACK_DELETE_ALL = "all"
@@ -84,8 +96,34 @@ const (
 	// Command line flag for stack list status.
 	CMD_STACK_LIST_STATUS = "status"
 
+	// Command line flag for stack graph format.
+	CMD_STACK_GRAPH_FORMAT = "format"
+
+	// Command line flag for colouring stack graph by stack status.
+	CMD_STACK_GRAPH_STATUS = "status"
+
+	// Env
+
+	// Command line flag for configuration file.
+	CMD_ENV_FILE = "file"
+
+	// Command line flag for envoirnment folder.
+	CMD_ENV_ENV = "env"
+
+	// Command line flag for showing vault encrypted values.
+	CMD_ENV_SHOW_REVEAL = "reveal"
+
+	// Command line flag for comparing rendered parameters.
+	CMD_ENV_DIFF_RENDERED = "rendered"
+
+	// Command line flag for showing vault encrypted values in diff.
+	CMD_ENV_DIFF_REVEAL = "reveal"
+
 	// Template
 
 	// Command line flag for template validate recursively.
 	CMD_TEMPLATE_VALIDATE_RECURSIVE = "recursive"
+
+	// Command line flag for template validate without calling AWS.
+	CMD_TEMPLATE_VALIDATE_OFFLINE = "offline"
 )
@@ -0,0 +1,329 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/liangrog/cfctl/pkg/conf"
+	"github.com/liangrog/cfctl/pkg/template/parser"
+	"github.com/liangrog/cfctl/pkg/utils"
+	"github.com/liangrog/cfctl/pkg/utils/i18n"
+	"github.com/liangrog/cfctl/pkg/utils/templates"
+	"github.com/spf13/cobra"
+)
+
+var (
+	envDiffShort = i18n.T("Compare values of two environments")
+
+	envDiffLong = templates.LongDesc(i18n.T(`
+		Compare the merged values of two environments, including values from
+		vault encrypted files, and show the added, removed and changed keys.
+		Values from vault encrypted files are masked unless '--reveal' is
+		given.
+
+		With '--rendered', the parameter files of all stacks are also rendered
+		for both environments and the resulting parameters are compared per
+		stack. Rendering is local, nested templates aren't uploaded and stack
+		outputs are shown as placeholders. Parameters rendered from values of
+		vault encrypted files are masked as well. Stacks are paired by their
+		names, where names only differing by the environment name, e.g.
+		"{{ .Env }}-vpc", are the same stack.`))
+
+	envDiffExample = templates.Examples(i18n.T(`
+		# Compare values of staging and production environments
+		$ cfctl env diff staging production
+
+		# Compare values and rendered stack parameters
+		$ cfctl env diff staging production --rendered --vault-password-file path/to/password/file
+
+		# Show the values from vault encrypted files
+		$ cfctl env diff staging production --reveal --vault-password-file path/to/password/file`))
+)
+
+// Register sub commands
+func init() {
+	cmd := getCmdEnvDiff()
+	addFlagsEnvDiff(cmd)
+
+	CmdEnv.AddCommand(cmd)
+}
+
+func addFlagsEnvDiff(cmd *cobra.Command) {
+	cmd.Flags().BoolP(CMD_ENV_DIFF_RENDERED, "", false, "also compare the rendered parameters of every stack")
+	cmd.Flags().BoolP(CMD_ENV_DIFF_REVEAL, "", false, "show values from vault encrypted files")
+}
+
+// cmd: env diff
+func getCmdEnvDiff() *cobra.Command {
+	return &cobra.Command{
+		Use:     "diff [from env] [to env]",
+		Short:   envDiffShort,
+		Long:    envDiffLong,
+		Example: fmt.Sprintf(envDiffExample),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return errors.New("Please provide two environments to compare")
+			}
+
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rendered, _ := cmd.Flags().GetBool(CMD_ENV_DIFF_RENDERED)
+			reveal, _ := cmd.Flags().GetBool(CMD_ENV_DIFF_REVEAL)
+
+			passes, err := getVaultPasswords(cmd)
+			if err == nil {
+				err = envDiff(
+					cmd.Flags().Lookup(CMD_ENV_FILE).Value.String(),
+					args[0],
+					args[1],
+					passes,
+					rendered,
+					reveal,
+					cmd.Flags().Lookup(CMD_ROOT_OUTPUT).Value.String(),
+				)
+			}
+
+			silenceUsageOnError(cmd, err)
+
+			return err
+		},
+	}
+}
+
+// Parameter differences of a stack
+type stackParamDiff struct {
+	Stack  string            `json:"stack" yaml:"stack"`
+	Params []*conf.ValueDiff `json:"params" yaml:"params"`
+}
+
+// Differences between two environments
+type envDiffResult struct {
+	Values []*conf.ValueDiff `json:"values" yaml:"values"`
+	Stacks []*stackParamDiff `json:"stacks,omitempty" yaml:"stacks,omitempty"`
+}
+
+// Environment loaded for comparing
+type envDiffSide struct {
+	name string
+	dc   *conf.DeployConfig
+	kv   map[string]interface{}
+
+	// Where each value comes from
+	prov conf.Provenance
+}
+
+// Load an environment for comparing
+func loadEnvDiffSide(f, env string, vaultPass []string) (*envDiffSide, error) {
+	dc, kv, prov, err := loadDeployConfigWithSource(f, env, vaultPass, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	side := &envDiffSide{dc: dc, kv: kv, prov: prov}
+	if envs := conf.SplitEnvs(env); len(envs) > 0 {
+		side.name = envs[0]
+	}
+
+	return side, nil
+}
+
+// If a value is from a vault encrypted file
+func (side *envDiffSide) isSecret(key string) bool {
+	src, ok := side.prov[key]
+	return ok && src.Vault
+}
+
+// Return the values with the ones from
+// vault encrypted files masked.
+func (side *envDiffSide) maskedValues() map[string]interface{} {
+	var mask func(prefix string, m map[string]interface{}) map[string]interface{}
+	mask = func(prefix string, m map[string]interface{}) map[string]interface{} {
+		out := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			switch {
+			case side.isSecret(prefix + k):
+				out[k] = maskedValue
+			default:
+				if sub, ok := v.(map[string]interface{}); ok {
+					out[k] = mask(prefix+k+".", sub)
+				} else {
+					out[k] = v
+				}
+			}
+		}
+
+		return out
+	}
+
+	return mask("", side.kv)
+}
+
+// Mask both sides of differences by given checks
+func maskValueDiffs(diffs []*conf.ValueDiff, fromSecret, toSecret func(key string) bool) {
+	for _, d := range diffs {
+		if d.From != nil && fromSecret(d.Key) {
+			d.From = maskedValue
+		}
+
+		if d.To != nil && toSecret(d.Key) {
+			d.To = maskedValue
+		}
+	}
+}
+
+// Compare two environments
+func envDiff(f, from, to string, vaultPass []string, rendered, reveal bool, format string) error {
+	fromSide, err := loadEnvDiffSide(f, from, vaultPass)
+	if err != nil {
+		return err
+	}
+
+	toSide, err := loadEnvDiffSide(f, to, vaultPass)
+	if err != nil {
+		return err
+	}
+
+	result := &envDiffResult{Values: conf.DiffValues(fromSide.kv, toSide.kv)}
+	if !reveal {
+		maskValueDiffs(result.Values, fromSide.isSecret, toSide.isSecret)
+	}
+
+	if rendered {
+		if result.Stacks, err = diffStackParams(fromSide, toSide, reveal); err != nil {
+			return err
+		}
+	}
+
+	return utils.Print(utils.FormatType(format), result)
+}
+
+// Identity of a stack for pairing stacks of two
+// environments. Stack names may contain the
+// environment name, e.g. "{{ .Env }}-vpc". Only
+// whole words delimited by "-" or "_" are replaced
+// so "devops-dev-vpc" is "devops-{{ .Env }}-vpc".
+func stackIdentity(name, env string) string {
+	if len(env) == 0 {
+		return name
+	}
+
+	isDelim := func(i int) bool {
+		return i < 0 || i >= len(name) || name[i] == '-' || name[i] == '_'
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(name); {
+		if strings.HasPrefix(name[i:], env) && isDelim(i-1) && isDelim(i+len(env)) {
+			b.WriteString("{{ .Env }}")
+			i += len(env)
+			continue
+		}
+
+		b.WriteByte(name[i])
+		i++
+	}
+
+	return b.String()
+}
+
+// Render parameters of all stacks locally for both
+// environments and compare them per stack.
+func diffStackParams(from, to *envDiffSide, reveal bool) ([]*stackParamDiff, error) {
+	var diffs []*stackParamDiff
+
+	// Pair stacks by their identities in order of the stack files
+	var pairs [][2]*conf.StackConfig
+	toStacks := make(map[string]*conf.StackConfig)
+	for _, sc := range to.dc.Stacks {
+		toStacks[stackIdentity(sc.Name, to.name)] = sc
+	}
+
+	paired := make(map[*conf.StackConfig]bool)
+	for _, sc := range from.dc.Stacks {
+		tsc := toStacks[stackIdentity(sc.Name, from.name)]
+		if tsc != nil {
+			paired[tsc] = true
+		}
+
+		pairs = append(pairs, [2]*conf.StackConfig{sc, tsc})
+	}
+
+	for _, sc := range to.dc.Stacks {
+		if !paired[sc] {
+			pairs = append(pairs, [2]*conf.StackConfig{nil, sc})
+		}
+	}
+
+	// Render without uploading or looking up stack outputs
+	dr := parser.NewDryRun(nil)
+	dr.Offline = true
+	parser.EnableDryRun(dr)
+	defer parser.EnableDryRun(nil)
+
+	// Render stack parameters as values
+	render := func(dc *conf.DeployConfig, sc *conf.StackConfig, kv map[string]interface{}) (map[string]interface{}, error) {
+		values := make(map[string]interface{})
+		if sc == nil || !sc.IsEnabled() {
+			return values, nil
+		}
+
+		params, err := renderStackParams(dc, sc, kv)
+		if err != nil {
+			return nil, err
+		}
+
+		for k, v := range params.Parameters {
+			values[k] = v
+		}
+
+		return values, nil
+	}
+
+	// Parameters rendered from secrets change when the
+	// secrets are masked. If they can't be rendered that
+	// way, all parameters of the stack are taken as secrets.
+	secretParams := func(side *envDiffSide, sc *conf.StackConfig, params map[string]interface{}) func(string) bool {
+		masked, err := render(side.dc, sc, side.maskedValues())
+		return func(key string) bool {
+			return err != nil || masked[key] != params[key]
+		}
+	}
+
+	for _, p := range pairs {
+		fromParams, err := render(from.dc, p[0], from.kv)
+		if err != nil {
+			return nil, err
+		}
+
+		toParams, err := render(to.dc, p[1], to.kv)
+		if err != nil {
+			return nil, err
+		}
+
+		d := conf.DiffValues(fromParams, toParams)
+		if len(d) == 0 {
+			continue
+		}
+
+		if !reveal {
+			maskValueDiffs(d, secretParams(from, p[0], fromParams), secretParams(to, p[1], toParams))
+		}
+
+		// Name the stack pair
+		var name string
+		switch {
+		case p[0] == nil:
+			name = p[1].Name
+		case p[1] == nil || p[0].Name == p[1].Name:
+			name = p[0].Name
+		default:
+			name = fmt.Sprintf("%s -> %s", p[0].Name, p[1].Name)
+		}
+
+		diffs = append(diffs, &stackParamDiff{Stack: name, Params: d})
+	}
+
+	return diffs, nil
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/liangrog/cfctl/pkg/conf"
+	"github.com/liangrog/cfctl/pkg/template/funcs"
+	"github.com/liangrog/cfctl/pkg/utils"
+	"github.com/liangrog/cfctl/pkg/utils/i18n"
+	"github.com/liangrog/cfctl/pkg/utils/templates"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// Mask for vault encrypted values
+	maskedValue = "******"
+)
+
+var (
+	envShowShort = i18n.T("Show merged environment values and where they come from")
+
+	envShowLong = templates.LongDesc(i18n.T(`
+		Show the merged values of an environment. For every value, it shows
+		the file it comes from and the files it overrides. Values from vault
+		encrypted files are masked unless '--reveal' is given.`))
+
+	envShowExample = templates.Examples(i18n.T(`
+		# Show all values for production environment
+		$ cfctl env show --env production
+
+		# Show a specific value and all values under it
+		$ cfctl env show --env production db
+
+		# Show values including the ones from encrypted files
+		$ cfctl env show --env production --reveal --vault-password-file path/to/password/file`))
+)
+
+// Register sub commands
+func init() {
+	cmd := getCmdEnvShow()
+	addFlagsEnvShow(cmd)
+
+	CmdEnv.AddCommand(cmd)
+}
+
+func addFlagsEnvShow(cmd *cobra.Command) {
+	cmd.Flags().String(CMD_ENV_ENV, "", "set enviornment folder you want to load values from. Multiple environments can be layered by using comma delimiter, e.g. 'prod,hotfix'")
+	cmd.Flags().BoolP(CMD_ENV_SHOW_REVEAL, "", false, "show values from vault encrypted files")
+}
+
+// cmd: env show
+func getCmdEnvShow() *cobra.Command {
+	return &cobra.Command{
+		Use:     "show [key]",
+		Short:   envShowShort,
+		Long:    envShowLong,
+		Example: fmt.Sprintf(envShowExample),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reveal, _ := cmd.Flags().GetBool(CMD_ENV_SHOW_REVEAL)
+
+			var key string
+			if len(args) > 0 {
+				key = args[0]
+			}
+
+			passes, err := getVaultPasswords(cmd)
+			if err == nil {
+				err = envShow(
+					cmd.Flags().Lookup(CMD_ENV_FILE).Value.String(),
+					cmd.Flags().Lookup(CMD_ENV_ENV).Value.String(),
+					passes,
+					key,
+					reveal,
+					cmd.Flags().Lookup(CMD_ROOT_OUTPUT).Value.String(),
+				)
+			}
+
+			silenceUsageOnError(cmd, err)
+
+			return err
+		},
+	}
+}
+
+// A value with its source
+type envShowItem struct {
+	Key       string      `json:"key" yaml:"key"`
+	Value     interface{} `json:"value" yaml:"value"`
+	Source    string      `json:"source" yaml:"source"`
+	Overrides []string    `json:"overrides,omitempty" yaml:"overrides,omitempty"`
+}
+
+// Show environment values with their sources
+func envShow(f, env string, vaultPass []string, key string, reveal bool, format string) error {
+	// Only the environment directory is needed.
+	dc, err := conf.NewDeployConfigWithoutValues(f, env)
+	if err != nil {
+		return err
+	}
+
+	root := dc.GetEnvDirPath("")
+	values, prov, err := conf.LoadEnvValuesWithSource(root, conf.SplitEnvs(env), vaultPass)
+	if err != nil {
+		return err
+	}
+
+	// Show the resolved values of templated values
+	if values, err = conf.InterpolateValuesWithSource(values, prov, funcs.ValueFuncMap()); err != nil {
+		return err
+	}
+
+	// Show file path relative to environment directory
+	relPath := func(p string) string {
+		if rel, err := filepath.Rel(root, p); err == nil {
+			return rel
+		}
+
+		return p
+	}
+
+	var items []*envShowItem
+	for k, v := range conf.FlattenValues(values) {
+		if len(key) > 0 && k != key && !strings.HasPrefix(k, key+".") {
+			continue
+		}
+
+		item := &envShowItem{Key: k, Value: v}
+		if src, ok := prov[k]; ok {
+			item.Source = relPath(src.File)
+			for _, o := range src.Overrides {
+				item.Overrides = append(item.Overrides, relPath(o))
+			}
+
+			if src.Vault && !reveal {
+				item.Value = maskedValue
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	if len(items) == 0 {
+		utils.StdoutWarn(fmt.Sprintf("No value found.\n"))
+		return nil
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+
+	return utils.Print(utils.FormatType(format), items)
+}
@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/liangrog/cfctl/pkg/conf"
+	"github.com/liangrog/cfctl/pkg/template/funcs"
+	"github.com/liangrog/cfctl/pkg/template/parser"
+	"github.com/liangrog/cfctl/pkg/utils"
+	"github.com/liangrog/cfctl/pkg/utils/i18n"
+	"github.com/liangrog/cfctl/pkg/utils/templates"
+	"github.com/spf13/cobra"
+)
+
+var (
+	envValidateShort = i18n.T("Validate environment values against the values schema and their usage")
+
+	envValidateLong = templates.LongDesc(i18n.T(`
+		Validate the merged values of an environment against the values schema
+		file if it exists. The schema file is 'values.schema.yaml' in the same
+		directory as the envDir unless 'valuesSchema' is set in the stack file.
+
+		It also scans all parameter files, the stack file, templated templates
+		and templated values for referenced values. Values that are referenced
+		but not defined are errors. Values that are defined but never
+		referenced are reported as unused.`))
+
+	envValidateExample = templates.Examples(i18n.T(`
+		# Validate production environment
+		$ cfctl env validate --env production --vault-password-file path/to/password/file`))
+)
+
+// Register sub commands
+func init() {
+	cmd := getCmdEnvValidate()
+	addFlagsEnvValidate(cmd)
+
+	CmdEnv.AddCommand(cmd)
+}
+
+func addFlagsEnvValidate(cmd *cobra.Command) {
+	cmd.Flags().String(CMD_ENV_ENV, "", "set enviornment folder you want to validate. Multiple environments can be layered by using comma delimiter, e.g. 'prod,hotfix'")
+}
+
+// cmd: env validate
+func getCmdEnvValidate() *cobra.Command {
+	return &cobra.Command{
+		Use:     "validate",
+		Short:   envValidateShort,
+		Long:    envValidateLong,
+		Example: fmt.Sprintf(envValidateExample),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			passes, err := getVaultPasswords(cmd)
+			if err == nil {
+				err = envValidate(
+					cmd.Flags().Lookup(CMD_ENV_FILE).Value.String(),
+					cmd.Flags().Lookup(CMD_ENV_ENV).Value.String(),
+					passes,
+					cmd.Flags().Lookup(CMD_ROOT_OUTPUT).Value.String(),
+				)
+			}
+
+			silenceUsageOnError(cmd, err)
+
+			return err
+		},
+	}
+}
+
+// Result of environment validation
+type envValidateResult struct {
+	Errors    []*conf.ValueError `json:"errors,omitempty" yaml:"errors,omitempty"`
+	Undefined []*conf.ValueRef   `json:"undefined,omitempty" yaml:"undefined,omitempty"`
+	Unused    []string           `json:"unused,omitempty" yaml:"unused,omitempty"`
+}
+
+// Validate environment values
+func envValidate(f, env string, vaultPass []string, format string) error {
+	// Only the environment directory is needed first
+	dc, err := conf.NewDeployConfigWithoutValues(f, env)
+	if err != nil {
+		return err
+	}
+
+	kv, prov, err := conf.LoadEnvValuesWithSource(dc.GetEnvDirPath(""), conf.SplitEnvs(env), vaultPass)
+	if err != nil {
+		return err
+	}
+
+	// Values referencing other values, before they are resolved
+	valueRefs, err := conf.ValueTemplateRefsWithSource(kv, prov, funcs.ValueFuncMap())
+	if err != nil {
+		return err
+	}
+
+	// Values and the stack file may fail to render because of
+	// undefined values. They are reported as undefined values
+	// below, so the failures are only returned if none are found.
+	var failures []error
+	if resolved, err := conf.InterpolateValuesWithSource(kv, prov, funcs.ValueFuncMap()); err != nil {
+		failures = append(failures, err)
+	} else {
+		kv = resolved
+	}
+
+	if full, err := conf.NewDeployConfigWithValues(f, env, kv); err != nil {
+		failures = append(failures, err)
+	} else {
+		dc = full
+	}
+
+	result := new(envValidateResult)
+
+	schema, err := conf.LoadValuesSchema(dc.GetValuesSchemaPath())
+	if err != nil {
+		return err
+	}
+
+	if schema != nil {
+		result.Errors = schema.Validate(kv)
+	}
+
+	refs, err := scanValueRefs(f, dc, valueRefs, prov)
+	if err != nil {
+		return err
+	}
+
+	result.Undefined = refs.Undefined(kv)
+	result.Unused = refs.Unused(kv)
+
+	if len(failures) > 0 && len(result.Undefined) == 0 {
+		return failures[0]
+	}
+
+	if len(result.Errors) == 0 && len(result.Undefined) == 0 && len(result.Unused) == 0 {
+		return utils.Print(utils.FormatType(format), "No error found")
+	}
+
+	if err := utils.Print(utils.FormatType(format), result); err != nil {
+		return err
+	}
+
+	if len(result.Errors) > 0 || len(result.Undefined) > 0 {
+		return errors.New(fmt.Sprintf("Environment values are invalid: %d schema errors, %d undefined values", len(result.Errors), len(result.Undefined)))
+	}
+
+	return nil
+}
+
+// Scan parameter files, stack file and templated templates for
+// the values they reference, plus the ones of templated values.
+func scanValueRefs(f string, dc *conf.DeployConfig, valueRefs map[string][]string, prov conf.Provenance) (conf.ValueRefs, error) {
+	refs := make(conf.ValueRefs)
+
+	if len(f) == 0 {
+		f = conf.DEFAULT_DEPLOY_CONFIG_FILE_NAME
+	}
+
+	files, err := utils.FindFiles(dc.GetParamPath(""), true)
+	if err != nil {
+		return nil, err
+	}
+
+	tpls, err := utils.FindFiles(dc.GetTplPath(""), true)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range tpls {
+		if conf.IsTemplatedFile(t) {
+			files = append(files, t)
+		}
+	}
+
+	for _, sc := range dc.Stacks {
+		if sc.Render {
+			files = append(files, dc.GetTplPath(sc.Tpl))
+		}
+
+		// Parameter files outside the paramDir
+		for _, p := range dc.GetStackParamPaths(sc) {
+			if !utils.InSlice(files, p) {
+				files = append(files, p)
+			}
+		}
+	}
+
+	stackFiles := dc.GetStackFiles()
+	if !utils.InSlice(stackFiles, f) {
+		stackFiles = append(stackFiles, f)
+	}
+
+	files = append(files, stackFiles...)
+
+	// The item of stacks expanded from forEach is built-in
+	var hasItem bool
+	for _, sc := range dc.Stacks {
+		if sc.Item() != nil {
+			hasItem = true
+		}
+
+		if sc.ForEach != nil && len(sc.ForEach.Value) > 0 {
+			refs.Add(displayPath(sc.Source()), []string{sc.ForEach.Value})
+		}
+	}
+
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		found, err := conf.TemplateRefs(string(content), parser.ScanFuncMap())
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to parse %s: %s", file, err))
+		}
+
+		// The environment name is built-in for stack files
+		isStackFile := utils.InSlice(stackFiles, file)
+
+		// Stack settings rendered after the stack file
+		if isStackFile {
+			deferred, err := conf.TemplateRefsDelims(string(content), conf.DEFERRED_LEFT_DELIM, conf.DEFERRED_RIGHT_DELIM, parser.ScanFuncMap())
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("Failed to parse %s: %s", file, err))
+			}
+
+			found = append(found, deferred...)
+		}
+
+		var userRefs []string
+		for _, r := range found {
+			switch {
+			case isStackFile && (r == conf.CONFIG_DATA_ENV || r == conf.CONFIG_DATA_ENVS):
+			case hasItem && (r == conf.STACK_DATA_ITEM || strings.HasPrefix(r, conf.STACK_DATA_ITEM+".")):
+			default:
+				userRefs = append(userRefs, r)
+			}
+		}
+
+		found = userRefs
+
+		refs.Add(displayPath(file), found)
+	}
+
+	// Values referencing other values
+	for path, found := range valueRefs {
+		refs.Add(displayPath(prov[path].File), found)
+	}
+
+	return refs, nil
+}
+
+// Return path relative to current directory if possible
+func displayPath(p string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return p
+	}
+
+	if rel, err := filepath.Rel(wd, p); err == nil {
+		return rel
+	}
+
+	return p
+}
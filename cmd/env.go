@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"github.com/liangrog/cfctl/pkg/utils/i18n"
+	"github.com/liangrog/cfctl/pkg/utils/templates"
+	"github.com/spf13/cobra"
+)
+
+var CmdEnv = getCmdEnv()
+
+var (
+	envShort = i18n.T("Commands for inspecting environment values.")
+
+	envLong = templates.LongDesc(i18n.T(`Inspect the values loaded from the environment folders`))
+)
+
+// Register sub commands
+func init() {
+	Cmds.AddCommand(CmdEnv)
+
+	CmdEnv.PersistentFlags().StringP(CMD_ENV_FILE, "f", "", "alternative stack configuration file (Default is './stacks.yaml')")
+	CmdEnv.PersistentFlags().StringP(CMD_VAULT_PASSWORD, "", "", "vault password for encryption or decryption")
+	CmdEnv.PersistentFlags().StringP(CMD_VAULT_PASSWORD_FILE, "", "", "file that contains vault passwords for encryption or decryption")
+}
+
+// cmd: env
+func getCmdEnv() *cobra.Command {
+	return &cobra.Command{
+		Use:   "env",
+		Short: envShort,
+		Long:  envLong,
+	}
+}
@@ -0,0 +1,495 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	ctlaws "github.com/liangrog/cfctl/pkg/aws"
+	"github.com/liangrog/cfctl/pkg/conf"
+	"github.com/liangrog/cfctl/pkg/template/parser"
+	"github.com/liangrog/cfctl/pkg/utils"
+	"github.com/liangrog/cfctl/pkg/utils/i18n"
+	"github.com/liangrog/cfctl/pkg/utils/templates"
+	"github.com/spf13/cobra"
+)
+
+// Version of the plan file format
+const planFileVersion = 1
+
+var (
+	stackApplyShort = i18n.T("Execute the change sets of a plan file")
+
+	stackApplyLong = templates.LongDesc(i18n.T(`
+		Execute the change sets saved by 'stack deploy --plan-out' in the
+		order of the plan, which is the dependency order of the stacks.
+		Stacks without change are skipped.
+
+		Before executing anything, every change set is checked against
+		the plan. The apply is refused if a change set doesn't exist any
+		more, isn't available to execute, or its parameters, tags or
+		changes differ from the plan, or if a stack has been updated,
+		deleted or recreated since the plan was made.
+
+		The stack policy of a stack is set after its change set is
+		executed.
+
+		All change sets are created when the plan is made, so a stack
+		using outputs of another stack by 'stackOutput' can't be planned
+		together with it if that stack has changes. Such a plan is
+		refused, the other stack has to be planned and applied first.`))
+
+	stackApplyExample = templates.Examples(i18n.T(`
+		# Save change sets of all stacks for review
+		$ cfctl stack deploy --env production --plan-out plan.json
+
+		# Execute the reviewed change sets
+		$ cfctl stack apply plan.json`))
+)
+
+// Register sub commands
+func init() {
+	CmdStack.AddCommand(getCmdStackApply())
+}
+
+// cmd: stack apply
+func getCmdStackApply() *cobra.Command {
+	return &cobra.Command{
+		Use:     "apply PLAN_FILE",
+		Short:   stackApplyShort,
+		Long:    stackApplyLong,
+		Example: fmt.Sprintf(stackApplyExample),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New(utils.MsgFormat("One plan file is required", utils.MessageTypeError))
+			}
+
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := stackApply(args[0])
+
+			silenceUsageOnError(cmd, err)
+
+			return err
+		},
+	}
+}
+
+// Change sets saved for review and executed later
+type deployPlan struct {
+	Version int    `json:"version"`
+	Created string `json:"created"`
+
+	// Stacks in the order to deploy
+	Stacks []*plannedStack `json:"stacks"`
+}
+
+// Change set of a stack in the plan
+type plannedStack struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+
+	// Empty if there is no change
+	ChangeSetId string `json:"changeSetId,omitempty"`
+
+	// The stack when the plan was made
+	StackId      string `json:"stackId,omitempty"`
+	StackUpdated string `json:"stackUpdated,omitempty"`
+
+	// Hash of parameters, tags and changes of the change set
+	Fingerprint string `json:"fingerprint,omitempty"`
+
+	Changes []*plannedChange `json:"changes,omitempty"`
+
+	// Set after the change set is executed
+	StackPolicy string `json:"stackPolicy,omitempty"`
+
+	// The stack was created in REVIEW_IN_PROGRESS
+	// for the change set when planning
+	created bool
+}
+
+// Resource change of a change set
+type plannedChange struct {
+	Action      string `json:"action"`
+	LogicalId   string `json:"logicalId"`
+	Type        string `json:"type"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// Create change sets for sorted stacks and save them
+// in a plan file without executing.
+func planOutStacks(dc *conf.DeployConfig, kv map[string]interface{}, sl map[string]*conf.StackConfig, sorted []string, stack *ctlaws.Stack, planOut string) error {
+	plan := &deployPlan{
+		Version: planFileVersion,
+		Created: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	changeSetName := fmt.Sprintf("cfctl-%s", time.Now().UTC().Format("20060102150405"))
+
+	// Change sets aren't left behind if the plan can't be saved
+	saved := false
+	defer func() {
+		if !saved {
+			for _, ps := range plan.Stacks {
+				discardPlannedStack(stack, ps)
+			}
+		}
+	}()
+
+	planned := make(map[string]*plannedStack)
+	for _, name := range sorted {
+		// Stacks not in given stack list are only dependencies
+		sc, ok := sl[name]
+		if !ok {
+			continue
+		}
+
+		fmt.Println("")
+
+		if err := checkPlannedDependencies(dc, sc, kv, planned); err != nil {
+			return err
+		}
+
+		ps, err := planOutStack(dc, sc, kv, stack, changeSetName)
+		if err != nil {
+			return err
+		}
+
+		plan.Stacks = append(plan.Stacks, ps)
+		planned[ps.Name] = ps
+
+		utils.InfoPrint(fmt.Sprintf("[ stack | plan ] name: %s\taction: %s\tchanges: %d", ps.Name, ps.Action, len(ps.Changes)))
+	}
+
+	out, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(planOut, append(out, '\n'), 0644); err != nil {
+		return err
+	}
+
+	saved = true
+
+	counts := make(map[string]int)
+	for _, ps := range plan.Stacks {
+		counts[ps.Action]++
+	}
+
+	fmt.Println("")
+	utils.InfoPrint(fmt.Sprintf(
+		"Plan: %d to create, %d to update, %d unchanged. Saved to %s",
+		counts[stackActionCreate],
+		counts[stackActionUpdate],
+		counts[stackActionNoop],
+		planOut,
+	))
+
+	return nil
+}
+
+// Check a stack doesn't use outputs of stacks with changes
+// in the plan. Their outputs aren't known until the change
+// sets are executed.
+func checkPlannedDependencies(dc *conf.DeployConfig, sc *conf.StackConfig, kv map[string]interface{}, planned map[string]*plannedStack) error {
+	deps, err := stackDependencies(dc, sc, kv)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deps {
+		if ps, ok := planned[d]; ok && ps.Action != stackActionNoop {
+			return errors.New(fmt.Sprintf("Stack %s uses outputs of stack %s which is to %s in the plan. Deploy or plan stack %s first", sc.Name, d, ps.Action, d))
+		}
+	}
+
+	return nil
+}
+
+// Delete the change set of a planned stack, and the stack
+// too if it was only created for the change set.
+func discardPlannedStack(stack *ctlaws.Stack, ps *plannedStack) {
+	var err error
+	switch {
+	case ps.created:
+		_, err = stack.DeleteStack(ps.Name)
+	case len(ps.ChangeSetId) > 0:
+		err = stack.DeleteChangeSet(ps.ChangeSetId)
+	}
+
+	if err != nil {
+		utils.StdoutWarn(fmt.Sprintf("Failed to delete change set of %s: %s\n", ps.Name, err))
+	}
+}
+
+// Create the change set of a stack. The change set is deleted
+// if there is no change or it fails.
+func planOutStack(dc *conf.DeployConfig, sc *conf.StackConfig, kv map[string]interface{}, stack *ctlaws.Stack, changeSetName string) (*plannedStack, error) {
+	dat, err := parser.LoadTemplate(sc.Tpl, sc.IsTemplated(), sc.Values(kv), dc)
+	if err != nil {
+		return nil, err
+	}
+
+	params := conf.NewStackParams()
+	if sc.HasParams() {
+		if params, err = renderStackParams(dc, sc, kv); err != nil {
+			return nil, err
+		}
+	}
+
+	// A stack only created by a change set
+	// not executed yet is still created.
+	changeSetType := cf.ChangeSetTypeCreate
+	exist := false
+	if live, err := stack.DescribeStack(sc.Name); err == nil {
+		exist = true
+
+		status := aws.StringValue(live.StackStatus)
+		if status != cf.StackStatusReviewInProgress {
+			if msg := stackStatusProblem(status); len(msg) > 0 {
+				return nil, errors.New(fmt.Sprintf("%s: %s", sc.Name, msg))
+			}
+
+			changeSetType = cf.ChangeSetTypeUpdate
+		}
+	}
+
+	out, err := stack.CreateChangeSet(
+		sc.Name,
+		changeSetName,
+		changeSetType,
+		params.Parameters,
+		stackTags(sc, params),
+		dat,
+		"",
+		&ctlaws.StackOptions{UsePreviousValue: params.UsePreviousValue},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ps := &plannedStack{
+		Name:        sc.Name,
+		Action:      stackActionUpdate,
+		ChangeSetId: aws.StringValue(out.Id),
+		StackPolicy: params.StackPolicy,
+		created:     !exist,
+	}
+
+	if changeSetType == cf.ChangeSetTypeCreate {
+		ps.Action = stackActionCreate
+	}
+
+	cs, err := stack.WaitChangeSet(ps.ChangeSetId)
+	if err != nil {
+		discardPlannedStack(stack, ps)
+		return nil, err
+	}
+
+	if ctlaws.IsNoChange(cs) {
+		discardPlannedStack(stack, ps)
+
+		return &plannedStack{Name: sc.Name, Action: stackActionNoop}, nil
+	}
+
+	if aws.StringValue(cs.Status) != cf.ChangeSetStatusCreateComplete {
+		discardPlannedStack(stack, ps)
+		return nil, errors.New(fmt.Sprintf("Failed to create change set of stack %s: %s", sc.Name, aws.StringValue(cs.StatusReason)))
+	}
+
+	live, err := stack.DescribeStack(sc.Name)
+	if err != nil {
+		discardPlannedStack(stack, ps)
+		return nil, err
+	}
+
+	ps.StackId = aws.StringValue(live.StackId)
+	ps.StackUpdated = stackUpdated(live)
+	ps.Changes = plannedChanges(cs)
+
+	if ps.Fingerprint, err = changeSetFingerprint(cs); err != nil {
+		discardPlannedStack(stack, ps)
+		return nil, err
+	}
+
+	for _, c := range ps.Changes {
+		fmt.Printf("[ stack | change ] name: %s\taction: %s\tresource: %s\ttype: %s\treplacement: %s\n", sc.Name, c.Action, c.LogicalId, c.Type, c.Replacement)
+	}
+
+	return ps, nil
+}
+
+// Return when a stack was last updated or created
+func stackUpdated(s *cf.Stack) string {
+	t := s.CreationTime
+	if s.LastUpdatedTime != nil {
+		t = s.LastUpdatedTime
+	}
+
+	return aws.TimeValue(t).UTC().Format(time.RFC3339Nano)
+}
+
+// Return resource changes of a change set
+func plannedChanges(cs *cf.DescribeChangeSetOutput) []*plannedChange {
+	var changes []*plannedChange
+	for _, c := range cs.Changes {
+		if c.ResourceChange == nil {
+			continue
+		}
+
+		changes = append(changes, &plannedChange{
+			Action:      aws.StringValue(c.ResourceChange.Action),
+			LogicalId:   aws.StringValue(c.ResourceChange.LogicalResourceId),
+			Type:        aws.StringValue(c.ResourceChange.ResourceType),
+			Replacement: aws.StringValue(c.ResourceChange.Replacement),
+		})
+	}
+
+	return changes
+}
+
+// Hash parameters, tags, capabilities and changes of a change set
+func changeSetFingerprint(cs *cf.DescribeChangeSetOutput) (string, error) {
+	params := append([]*cf.Parameter{}, cs.Parameters...)
+	sort.Slice(params, func(i, j int) bool {
+		return aws.StringValue(params[i].ParameterKey) < aws.StringValue(params[j].ParameterKey)
+	})
+
+	tags := append([]*cf.Tag{}, cs.Tags...)
+	sort.Slice(tags, func(i, j int) bool {
+		return aws.StringValue(tags[i].Key) < aws.StringValue(tags[j].Key)
+	})
+
+	dat, err := json.Marshal(map[string]interface{}{
+		"parameters":   params,
+		"tags":         tags,
+		"capabilities": cs.Capabilities,
+		"changes":      cs.Changes,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(dat)), nil
+}
+
+// Load a plan file
+func loadDeployPlan(f string) (*deployPlan, error) {
+	dat, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := new(deployPlan)
+	if err := json.Unmarshal(dat, plan); err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid plan file %s: %s", f, err))
+	}
+
+	if plan.Version != planFileVersion {
+		return nil, errors.New(fmt.Sprintf("Unsupported plan file version %d, expected %d", plan.Version, planFileVersion))
+	}
+
+	return plan, nil
+}
+
+// Execute change sets of a plan file in order
+func stackApply(f string) error {
+	plan, err := loadDeployPlan(f)
+	if err != nil {
+		return err
+	}
+
+	stack := ctlaws.NewStack(cf.New(ctlaws.AWSSess))
+
+	// Check all change sets before executing any
+	var errs []*stackError
+	for _, ps := range plan.Stacks {
+		if len(ps.ChangeSetId) == 0 {
+			continue
+		}
+
+		if msg := verifyPlannedStack(stack, ps); len(msg) > 0 {
+			errs = append(errs, &stackError{Stack: ps.Name, Message: msg})
+			utils.StdoutError(fmt.Sprintf("[ stack | apply ] %s\t%s\n", ps.Name, msg))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(fmt.Sprintf("Plan can't be applied: %d of %d stacks differ from the plan", len(errs), len(plan.Stacks)))
+	}
+
+	for _, ps := range plan.Stacks {
+		fmt.Println("")
+
+		if len(ps.ChangeSetId) == 0 {
+			utils.StdoutInfo(fmt.Sprintf("No updates are to be performed for %s\n", ps.Name))
+			continue
+		}
+
+		fmt.Printf("[ stack | apply ] name: %s\tchange set: %s\n", ps.Name, ps.ChangeSetId)
+
+		if err := stack.ExecuteChangeSet(ps.ChangeSetId); err != nil {
+			return err
+		}
+
+		waiterType := ctlaws.StackWaiterTypeUpdate
+		if ps.Action == stackActionCreate {
+			waiterType = ctlaws.StackWaiterTypeCreate
+		}
+
+		if err := stack.PollStackEvents(ps.Name, waiterType); err != nil {
+			return err
+		}
+
+		if len(ps.StackPolicy) > 0 {
+			if err := stack.SetStackPolicy(ps.Name, ps.StackPolicy); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Check a change set and its stack are the same as
+// planned. Return the problem, empty if none.
+func verifyPlannedStack(stack *ctlaws.Stack, ps *plannedStack) string {
+	cs, err := stack.DescribeChangeSet(ps.ChangeSetId)
+	if err != nil {
+		return fmt.Sprintf("Change set %s can't be found: %s", ps.ChangeSetId, err)
+	}
+
+	if aws.StringValue(cs.Status) != cf.ChangeSetStatusCreateComplete || aws.StringValue(cs.ExecutionStatus) != cf.ExecutionStatusAvailable {
+		return fmt.Sprintf("Change set isn't available to execute, status: %s, execution status: %s", aws.StringValue(cs.Status), aws.StringValue(cs.ExecutionStatus))
+	}
+
+	if fp, err := changeSetFingerprint(cs); err != nil {
+		return err.Error()
+	} else if fp != ps.Fingerprint {
+		return "Change set has been modified since the plan was made"
+	}
+
+	live, err := stack.DescribeStack(ps.Name)
+	if err != nil {
+		return fmt.Sprintf("Stack can't be found: %s", err)
+	}
+
+	if aws.StringValue(live.StackId) != ps.StackId {
+		return "Stack has been recreated since the plan was made"
+	}
+
+	if updated := stackUpdated(live); updated != ps.StackUpdated {
+		return fmt.Sprintf("Stack has been updated at %s since the plan was made", updated)
+	}
+
+	return ""
+}
@@ -31,7 +31,10 @@ var (
 		$ cfctl stack delete --file stack-file.yaml --all
 	
 		# Delete stacks that have specific tag values
-		$ cfctl sack delete --tags Name=stack-1,Type=frontend`))
+		$ cfctl sack delete --tags Name=stack-1,Type=frontend
+
+		# Delete all stacks whose names depend on the environment
+		$ cfctl stack delete --all --env production`))
 )
 
 // Register sub commands
@@ -43,6 +46,7 @@ func init() {
 }
 
 func addFlagsStackDelete(cmd *cobra.Command) {
+	addFlagEnv(cmd)
 	cmd.Flags().BoolP(CMD_STACK_DELETE_ALL, "", false, "delete all the stacks in the stack configuration file")
 	cmd.Flags().String(CMD_STACK_DELETE_RETAIN_RESOURCES, "", "retain resources during stack delete, e.g. S3 buckets that are not empty. Multiple resources seperated by comma.")
 }
@@ -71,6 +75,7 @@ func getCmdStackDelete() *cobra.Command {
 				args,
 				all,
 				cmd.Flags().Lookup(CMD_STACK_DEPLOY_FILE).Value.String(),
+				cmd.Flags().Lookup(CMD_STACK_DEPLOY_ENV).Value.String(),
 				cmd.Flags().Lookup(CMD_STACK_DEPLOY_TAGS).Value.String(),
 				cmd.Flags().Lookup(CMD_STACK_DELETE_RETAIN_RESOURCES).Value.String(),
 			)
@@ -85,13 +90,14 @@ func getCmdStackDelete() *cobra.Command {
 }
 
 // Delete stacks.
-func stackDelete(stackNames []string, all bool, stackConf, tags, retainRes string) error {
+func stackDelete(stackNames []string, all bool, stackConf, env string, tags, retainRes string) error {
 	var err error
 
-	stacks := make(map[string]*conf.StackConfig)
+	var stacks []*conf.StackConfig
 
-	// Load deploy configuration file.
-	dc, err := conf.NewDeployConfig(stackConf)
+	// Load deploy configuration file. Environment
+	// values aren't needed to find the stacks.
+	dc, err := conf.NewDeployConfigWithoutValues(stackConf, env)
 	if err != nil {
 		return err
 	}
@@ -99,7 +105,7 @@ func stackDelete(stackNames []string, all bool, stackConf, tags, retainRes strin
 	// If flag is set to all stacks, get
 	// stacks from configuration file.
 	if all {
-		stacks = dc.GetStackList(nil)
+		stacks = dc.GetStacks(nil)
 	} else {
 		filters := make(map[string]string)
 		if len(tags) > 0 {
@@ -110,7 +116,7 @@ func stackDelete(stackNames []string, all bool, stackConf, tags, retainRes strin
 			filters["name"] = strings.Join(stackNames, ",")
 		}
 
-		stacks = dc.GetStackList(filters)
+		stacks = dc.GetStacks(filters)
 	}
 
 	if len(stacks) == 0 {
@@ -118,7 +124,8 @@ func stackDelete(stackNames []string, all bool, stackConf, tags, retainRes strin
 	}
 
 	stack := ctlaws.NewStack(cf.New(ctlaws.AWSSess))
-	for sn, _ := range stacks {
+	for _, sc := range stacks {
+		sn := sc.Name
 		fmt.Println("")
 
 		// If stack name given
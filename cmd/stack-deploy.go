@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
+	"sort"
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -12,13 +15,12 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 	ctlaws "github.com/liangrog/cfctl/pkg/aws"
 	"github.com/liangrog/cfctl/pkg/conf"
+	"github.com/liangrog/cfctl/pkg/graph"
+	"github.com/liangrog/cfctl/pkg/template/funcs"
 	"github.com/liangrog/cfctl/pkg/template/parser"
 	"github.com/liangrog/cfctl/pkg/utils"
 	"github.com/liangrog/cfctl/pkg/utils/i18n"
 	"github.com/liangrog/cfctl/pkg/utils/templates"
-	gl "github.com/liangrog/ds/graph/list"
-	gp "github.com/liangrog/ds/graph/parts"
-	gs "github.com/liangrog/ds/graph/sort"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
 )
@@ -43,15 +45,33 @@ var (
 		# Deploy stacks using variables from specific environment that contains secrets and providing password file
 		$ cfctl stack deploy --env production --vault-password-file path/to/password/file
 
+		# Deploy stacks using variables layered from multiple environments
+		$ cfctl stack deploy --env production,hotfix
+
 		# Override environment values
-		$ cfctl stack deploy --env production --vault-password-file path/to/password/file --vars name1=value1,name2=value2
+		$ cfctl stack deploy --env production --vault-password-file path/to/password/file --var name1=value1 --var name2=value2
+
+		# Override environment values from files and environment variables
+		$ CFCTL_VAR_name1=value1 cfctl stack deploy --env production --var-file overrides.yaml
 
 		# Deploy stacks with specify tag values
 		$ cfctl stack deploy --stack stack1,stack2 --tags Type=frontend
 
+		# Deploy a stack together with the stacks it depends on and the stacks depending on it
+		$ cfctl stack deploy --stack stack1 --with-dependencies --with-dependents
+
+		# Validate all stacks and show the plan without deploying
+		$ cfctl stack deploy --env production --dry-run
+
+		# Create change sets of all stacks for review and execute them later by "stack apply"
+		$ cfctl stack deploy --env production --plan-out plan.json
+
 		# Output parameters only for all stacks
-		$ cfctl stack deploy --env production --param-only
-		
+		$ cfctl stack deploy --env production --param-only -o yaml
+
+		# Output parameters of a stack for "aws cloudformation deploy --parameter-overrides file://params.json"
+		$ cfctl stack deploy --env production --stack stack1 --param-only -o json > params.json
+
 		# Keeping stack when creation fails and in ROLLBACK_COMPLETE state
 		$ cfctl stack deploy --keep-stack-on-failure`))
 )
@@ -66,14 +86,15 @@ func init() {
 
 // Add flags to stack deploy command.
 func addFlagsStackDeploy(cmd *cobra.Command) {
-	cmd.PersistentFlags().StringP(CMD_VAULT_PASSWORD, "", "", "vault password for encryption or decryption")
-	cmd.PersistentFlags().StringP(CMD_VAULT_PASSWORD_FILE, "", "", "file that contains vault passwords for encryption or decryption")
-
-	cmd.Flags().BoolP(CMD_STACK_DEPLOY_DRY_RUN, "", false, "validate the templates and parse the parameters but not creating the stacks")
-	cmd.Flags().BoolP(CMD_STACK_DEPLOY_PARAM_ONLY, "", false, "only parsing the parameter files")
-	cmd.Flags().String(CMD_STACK_DEPLOY_ENV, "", "set enviornment folder you want to load values from")
+	addFlagsEnvValues(cmd)
+	cmd.Flags().BoolP(CMD_STACK_DEPLOY_DRY_RUN, "", false, "render and validate templates and parameters without uploading or deploying anything, and show the plan of each stack")
+	cmd.Flags().BoolP(CMD_STACK_DEPLOY_PARAM_ONLY, "", false, "only parsing the parameter files. With '-o json', parameters of a single stack are printed as CodePipeline template configuration")
+	cmd.Flags().String(CMD_STACK_DEPLOY_PLAN_OUT, "", "create change sets of the stacks without executing them and save them in the given plan file for 'stack apply'")
 	cmd.Flags().String(CMD_STACK_DEPLOY_STACK, "", "specify what stacks to run. If multiple stacks, use comma delimiter. For example: stackA,stackB")
 	cmd.Flags().String(CMD_STACK_DEPLOY_VARS, "", "specify variable override in the format of 'name=value'. If multiple , use comma delimiter.")
+	cmd.Flags().MarkDeprecated(CMD_STACK_DEPLOY_VARS, fmt.Sprintf("use --%s instead", CMD_STACK_DEPLOY_VAR))
+	cmd.Flags().BoolP(CMD_STACK_DEPLOY_WITH_DEPENDENCIES, "", false, "also deploy the stacks that the selected stacks depend on, directly or indirectly")
+	cmd.Flags().BoolP(CMD_STACK_DEPLOY_WITH_DEPENDENTS, "", false, "also deploy the stacks that depend on the selected stacks, directly or indirectly")
 	cmd.Flags().BoolP(CMD_STACK_DEPLOY_KEEP_STACK_ON_FAILURE, "", false, "do not delete the stack after creation fails and in ROLLBACK_COMPLETE state. Default the stack will be deleted")
 }
 
@@ -88,12 +109,9 @@ func getCmdStackDeploy() *cobra.Command {
 			dryRun, _ := cmd.Flags().GetBool(CMD_STACK_DEPLOY_DRY_RUN)
 			keepStack, _ := cmd.Flags().GetBool(CMD_STACK_DEPLOY_KEEP_STACK_ON_FAILURE)
 			paramOnly, _ := cmd.Flags().GetBool(CMD_STACK_DEPLOY_PARAM_ONLY)
-			passes, err := GetPasswords(
-				cmd.Flags().Lookup(CMD_VAULT_PASSWORD).Value.String(),
-				cmd.Flags().Lookup(CMD_VAULT_PASSWORD_FILE).Value.String(),
-				false,
-				true,
-			)
+			withDeps, _ := cmd.Flags().GetBool(CMD_STACK_DEPLOY_WITH_DEPENDENCIES)
+			withDependents, _ := cmd.Flags().GetBool(CMD_STACK_DEPLOY_WITH_DEPENDENTS)
+			passes, err := getVaultPasswords(cmd)
 
 			if err == nil {
 				err = deployStacks(
@@ -105,8 +123,11 @@ func getCmdStackDeploy() *cobra.Command {
 					dryRun,
 					paramOnly,
 					cmd.Flags().Lookup(CMD_ROOT_OUTPUT).Value.String(),
-					cmd.Flags().Lookup(CMD_STACK_DEPLOY_VARS).Value.String(),
+					getValueOverrides(cmd),
 					keepStack,
+					withDeps,
+					withDependents,
+					cmd.Flags().Lookup(CMD_STACK_DEPLOY_PLAN_OUT).Value.String(),
 				)
 			}
 
@@ -119,120 +140,359 @@ func getCmdStackDeploy() *cobra.Command {
 	return cmd
 }
 
-// Load key-value from a givenn environmennt folder.
-func loadEnvValues(vaultPass []string, dc *conf.DeployConfig, envFolder string) (map[string]string, error) {
-	values := make(map[string]string)
-	envValues := make(map[string]string)
+// Load key-value from given environment folders. Multiple
+// environments can be given seperated by comma.
+func loadEnvValues(vaultPass []string, dc *conf.DeployConfig, envFolder string) (map[string]interface{}, error) {
+	return conf.LoadEnvValues(dc.GetEnvDirPath(""), conf.SplitEnvs(envFolder), vaultPass)
+}
+
+// Search the stacks that given stack depends on via stackOutput
+// in its parameter file and its template if it's templated.
+func stackDependencies(dc *conf.DeployConfig, sc *conf.StackConfig, kv map[string]interface{}) ([]string, error) {
+	var sources []string
 
-	// Load key-values from "default" folder.
-	if yes, err := utils.IsDir(dc.GetEnvDirPath(STACK_DEPLOY_ENV_DEFAULT_FOLDER)); err == nil && yes {
-		values, err = conf.LoadValues(dc.GetEnvDirPath(STACK_DEPLOY_ENV_DEFAULT_FOLDER), vaultPass)
+	for _, p := range dc.GetStackParamPaths(sc) {
+		content, err := utils.LoadYaml(p)
 		if err != nil {
 			return nil, err
 		}
+
+		sources = append(sources, string(content))
 	}
 
-	// Load key-vaules from specified env folder.
-	if yes, err := utils.IsDir(dc.GetEnvDirPath(envFolder)); len(envFolder) > 0 && err == nil && yes {
-		envValues, err = conf.LoadValues(dc.GetEnvDirPath(envFolder), vaultPass)
+	if sc.IsTemplated() {
+		content, err := ioutil.ReadFile(dc.GetTplPath(sc.Tpl))
 		if err != nil {
 			return nil, err
 		}
+
+		sources = append(sources, string(content))
 	}
 
-	// Combine key-values by overriding default values with env values.
-	for k, v := range envValues {
-		values[k] = v
+	var dep []string
+	for _, src := range sources {
+		d, err := parser.SearchDependancy(src, sc.Values(kv))
+		if err != nil {
+			return nil, err
+		}
+
+		dep = append(dep, d...)
+	}
+
+	for _, v := range sc.Parameters {
+		d, err := parser.SearchDeferredDependancy(v, sc.Values(kv))
+		if err != nil {
+			return nil, err
+		}
+
+		dep = append(dep, d...)
 	}
 
-	return values, nil
+	return dep, nil
 }
 
-// Check if there is any cyclic dependency condition in stacks being
-// deployed and return a ordered list, providing priority to parent
-// stacks by building a graph and doing a Kahn sort.
-func ifCircularStacks(dc *conf.DeployConfig, sc map[string]*conf.StackConfig, kv map[string]string) (bool, []*gp.Vertice, error) {
-	// Anonymous function for creating vertice .
-	newVertice := func(name string) *gp.Vertice {
-		vertice := gp.NewVertice(name, gl.NewEdgeStore())
-		// Set vertice Id to stack name so
-		// we can search by it.
-		vertice.Value.SetId(name)
-		return vertice
-	}
-
-	// Create a directed graph.
-	g := gp.NewGraph(gp.DIRECTED, gl.NewVerticeStore())
-
-	// Loop through the stacks to create vertices.
-	for _, c := range sc {
-		// Create a node for current stack.
-		vertice := g.GetVerticeById(c.Name)
-		if vertice == nil {
-			vertice = newVertice(c.Name)
-		}
-
-		g.AddVertice(vertice)
-
-		// Only add other depending vertices
-		// and edges if parameters file exist.
-		if len(c.Param) > 0 {
-			// Load parameter file
-			content, err := utils.LoadYaml(dc.GetParamPath(c.Param))
-			if err != nil {
-				return false, nil, err
+// Render parameter files and inline parameters of given stack.
+// Parameter files are merged in order with inline parameters
+// last. Parameter files can be in any format decoded by
+// conf.DecodeStackParams, including tags and stack policy.
+func renderStackParams(dc *conf.DeployConfig, sc *conf.StackConfig, kv map[string]interface{}) (*conf.StackParams, error) {
+	params := conf.NewStackParams()
+	params.UsePreviousValue = append(params.UsePreviousValue, sc.UsePreviousValue...)
+
+	for _, p := range dc.GetStackParamPaths(sc) {
+		// Get Parameters.
+		paramTpl, err := utils.LoadYaml(p)
+		if err != nil {
+			return nil, err
+		}
+
+		// Parse parameter template.
+		paramBytes, err := parser.Parse(string(paramTpl), sc.IsTemplated(), sc.Values(kv), dc)
+		if err != nil {
+			return nil, err
+		}
+
+		fp, err := conf.DecodeStackParams(paramBytes)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to decode parameter file %s: %s", p, err))
+		}
+
+		params.Merge(fp)
+	}
+
+	var keys []string
+	for k := range sc.Parameters {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v, err := parser.ParseDeferred(sc.Parameters[k], sc.IsTemplated(), sc.Values(kv), dc)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to render parameter %s of stack %s: %s", k, sc.Name, err))
+		}
+
+		params.Parameters[k] = string(v)
+	}
+
+	return params, nil
+}
+
+// Value overrides from command line
+type valueOverrides struct {
+	// Variable files
+	varFiles []string
+
+	// Variables in the form of "key=value"
+	vars []string
+
+	// Comma delimited variables
+	varList string
+}
+
+// Override values in the order of variable files, environment
+// variables with prefix "CFCTL_VAR_" and then command line variables.
+func overrideValues(kv map[string]interface{}, ov *valueOverrides) (map[string]interface{}, error) {
+	for _, f := range ov.varFiles {
+		values, err := conf.LoadVarFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		kv = conf.MergeValues(kv, values)
+	}
+
+	kv = conf.MergeValues(kv, conf.EnvVars(os.Environ()))
+
+	values, err := conf.ParseVarList(ov.varList)
+	if err != nil {
+		return nil, err
+	}
+
+	kv = conf.MergeValues(kv, values)
+
+	values, err = conf.ParseVars(ov.vars)
+	if err != nil {
+		return nil, err
+	}
+
+	return conf.MergeValues(kv, values), nil
+}
+
+// Load deploy configuration file with values from given environment.
+// The configuration is loaded twice. The first pass only knows the
+// environment name so the environment folder can be located, it isn't
+// validated. The second pass renders the configuration with the
+// loaded values.
+// If overrides given, they are applied on top of environment values.
+// Templated values are resolved once all values are merged.
+func loadDeployConfig(f, env string, vaultPass []string, ov *valueOverrides) (*conf.DeployConfig, map[string]interface{}, error) {
+	dc, kv, _, err := loadDeployConfigWithSource(f, env, vaultPass, ov)
+	return dc, kv, err
+}
+
+// Load deploy config as loadDeployConfig does. It also
+// returns where each environment value comes from.
+func loadDeployConfigWithSource(f, env string, vaultPass []string, ov *valueOverrides) (*conf.DeployConfig, map[string]interface{}, conf.Provenance, error) {
+	dc, err := conf.NewDeployConfigWithoutValues(f, env)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	kv, prov, err := conf.LoadEnvValuesWithSource(dc.GetEnvDirPath(""), conf.SplitEnvs(env), vaultPass)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if ov != nil {
+		if kv, err = overrideValues(kv, ov); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if kv, err = conf.InterpolateValuesWithSource(kv, prov, funcs.ValueFuncMap()); err != nil {
+		return nil, nil, nil, err
+	}
+
+	dc, err = conf.NewDeployConfigWithValues(f, env, kv)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return dc, kv, prov, nil
+}
+
+// Build dependency graph for given stacks. Dependencies come from
+// stackOutput calls and "dependsOn" in the stack config. Stacks are
+// added in the order of the stack file so sorting is deterministic.
+func stackGraph(dc *conf.DeployConfig, sl map[string]*conf.StackConfig, kv map[string]interface{}) (*graph.Graph, error) {
+	g := graph.New()
+
+	for _, c := range dc.Stacks {
+		if _, ok := sl[c.Name]; !ok {
+			continue
+		}
+
+		g.AddNode(c.Name)
+
+		// Search for dependent stacks.
+		dep, err := stackDependencies(dc, c, kv)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, d := range c.DependsOn {
+			dsc := dc.GetStackConfigByName(d)
+			if dsc == nil {
+				return nil, errors.New(fmt.Sprintf("Stack %s depends on %s which isn't defined in the stack file.", c.Name, d))
 			}
 
-			// Search for dependent stacks.
-			dep, err := parser.SearchDependancy(string(content), kv)
-			if err != nil {
-				return false, nil, err
+			// Disabled stacks aren't deployed to wait for
+			if !dsc.IsEnabled() {
+				continue
 			}
 
-			// Add dependent stacks as nodes.
-			for _, p := range dep {
-				dv := g.GetVerticeById(p)
+			dep = append(dep, d)
+		}
 
-				if dv == nil {
-					dv = newVertice(p)
-					g.AddVertice(dv)
-				}
+		for _, d := range dep {
+			g.AddDependency(c.Name, d)
+		}
+	}
+
+	return g, nil
+}
+
+// Make stacks depend on the stacks in the previous wave
+// so a wave starts after all lower waves are deployed.
+func addWaveDependencies(g *graph.Graph, dc *conf.DeployConfig, sl map[string]*conf.StackConfig) {
+	waves := make(map[int][]string)
+	for _, c := range dc.Stacks {
+		if _, ok := sl[c.Name]; ok {
+			waves[c.GetWave()] = append(waves[c.GetWave()], c.Name)
+		}
+	}
 
-				// Add new edge to child node.
-				edge := gp.NewEdge(p, dv, gp.FROM)
-				vertice.AddEdge(edge)
+	var order []int
+	for w := range waves {
+		order = append(order, w)
+	}
+
+	sort.Ints(order)
+
+	for i := 1; i < len(order); i++ {
+		for _, n := range waves[order[i]] {
+			for _, d := range waves[order[i-1]] {
+				g.AddDependency(n, d)
 			}
+		}
+	}
+}
 
-			// Update graph and amend the missing edges.
-			g.UpdateVertice(vertice)
+// Sort given stacks by their dependencies and waves. The result
+// may contain stacks not in given list that they depend on. If the
+// stacks are circular dependent, the error shows the cycle.
+func sortStacks(dc *conf.DeployConfig, sl map[string]*conf.StackConfig, kv map[string]interface{}) ([]string, error) {
+	g, err := stackGraph(dc, sl, kv)
+	if err != nil {
+		return nil, err
+	}
+
+	addWaveDependencies(g, dc, sl)
+
+	if cycle := g.Cycle(); cycle != nil {
+		return nil, errors.New(fmt.Sprintf("The stack(s) in the stack list contains circular dependency: %s", strings.Join(cycle, " -> ")))
+	}
+
+	return g.Sort()
+}
+
+// Expand selected stacks with the stacks they depend on and/or
+// the stacks depending on them. The expanded selection is printed
+// to given writer.
+func expandStackSelection(w io.Writer, dc *conf.DeployConfig, sl map[string]*conf.StackConfig, kv map[string]interface{}, withDeps, withDependents bool) (map[string]*conf.StackConfig, error) {
+	g, err := stackGraph(dc, dc.GetStackList(nil), kv)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	reasons := make(map[string]string)
+	for _, c := range dc.Stacks {
+		if _, ok := sl[c.Name]; ok {
+			names = append(names, c.Name)
+			reasons[c.Name] = "selected"
 		}
 	}
 
-	return gs.Kahn(g)
+	if withDeps {
+		for _, n := range g.Ancestors(names...) {
+			if _, ok := reasons[n]; !ok {
+				reasons[n] = "dependency"
+			}
+		}
+	}
+
+	if withDependents {
+		for _, n := range g.Descendants(names...) {
+			if _, ok := reasons[n]; !ok {
+				reasons[n] = "dependent"
+			}
+		}
+	}
+
+	// Stacks not in the stack file, e.g. referenced
+	// by stackOutput only, can't be deployed.
+	result := make(map[string]*conf.StackConfig)
+	for _, c := range dc.Stacks {
+		if r, ok := reasons[c.Name]; ok {
+			result[c.Name] = c
+			fmt.Fprintf(w, "[ stack | select ] name: %s\treason: %s\n", c.Name, r)
+		}
+	}
+
+	return result, nil
 }
 
 // Deploy stacks.
-func deployStacks(f, env, named, tags string, vaultPass []string, dry, paramOnly bool, output string, vars string, keepStack bool) error {
+func deployStacks(f, env, named, tags string, vaultPass []string, dry, paramOnly bool, output string, ov *valueOverrides, keepStack, withDeps, withDependents bool, planOut string) error {
 	var err error
 
-	// Load deploy configuration file.
-	dc, err := conf.NewDeployConfig(f)
+	if len(planOut) > 0 && (dry || paramOnly) {
+		return errors.New(fmt.Sprintf("--%s can't be used with --%s or --%s", CMD_STACK_DEPLOY_PLAN_OUT, CMD_STACK_DEPLOY_DRY_RUN, CMD_STACK_DEPLOY_PARAM_ONLY))
+	}
+
+	// Load deploy configuration file and key-value from env folder.
+	dc, kv, err := loadDeployConfig(f, env, vaultPass, ov)
 	if err != nil {
 		return err
 	}
 
-	// Create S3 bucket if it doesn't exist.
-	cfs3 := ctlaws.NewS3(s3.New(ctlaws.AWSSess))
-	if exist, err := cfs3.IfBucketExist(dc.S3Bucket); err != nil {
-		return err
-	} else if !exist {
-		utils.StdoutWarn(fmt.Sprintf("s3 bucket %s doesn't exist. It will be created.", dc.S3Bucket))
+	// Only parameters go to stdout if parsing parameters
+	// so the output can be used by other tools.
+	logOut, warn := io.Writer(os.Stdout), utils.StdoutWarn
+	if paramOnly {
+		logOut, warn = os.Stderr, utils.StderrWarn
+	}
 
-		if _, err := cfs3.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(dc.S3Bucket)}); err != nil {
+	// Create S3 bucket if it doesn't exist. The bucket
+	// isn't needed for only parsing parameters.
+	if !paramOnly {
+		cfs3 := ctlaws.NewS3(s3.New(ctlaws.AWSSess))
+		if exist, err := cfs3.IfBucketExist(dc.S3Bucket); err != nil {
 			return err
+		} else if !exist {
+			utils.StdoutWarn(fmt.Sprintf("s3 bucket %s doesn't exist. It will be created.\n", dc.S3Bucket))
+
+			if !dry {
+				if _, err := cfs3.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(dc.S3Bucket)}); err != nil {
+					return err
+				}
+			}
+		} else {
+			utils.StdoutInfo(fmt.Sprintf("found s3 bucket %s\n", dc.S3Bucket))
 		}
-	} else {
-		utils.StdoutInfo(fmt.Sprintf("found s3 bucket %s\n", dc.S3Bucket))
 	}
 
 	// Retrieve the list of stacks and apply filters.
@@ -248,128 +508,140 @@ func deployStacks(f, env, named, tags string, vaultPass []string, dry, paramOnly
 
 	sl := dc.GetStackList(filters)
 
+	// List the stacks disabled for the environment
+	if dry {
+		for _, sc := range dc.GetDisabledStacks(filters) {
+			fmt.Printf("[ stack | disabled ] name: %s\treason: %s\n", sc.Name, sc.DisabledReason())
+		}
+	}
+
 	// If no stack found, send a warning.
 	if len(sl) == 0 {
-		utils.StdoutWarn(fmt.Sprintf("No stack found for given filters. No further actions.\n"))
+		warn(fmt.Sprintf("No stack found for given filters. No further actions.\n"))
 		return nil
 	}
 
-	// Load key-value from env folder.
-	kv, err := loadEnvValues(vaultPass, dc, env)
-	if err != nil {
+	// Check all stacks in the config file if it's cyclic
+	if _, err := sortStacks(dc, dc.GetStackList(nil), kv); err != nil {
 		return err
 	}
 
-	// Load var override
-	if len(vars) > 0 {
-		varlist := strings.Split(vars, ",")
-		for _, v := range varlist {
-			vkv := strings.Split(v, "=")
-			kv[vkv[0]] = vkv[1]
+	if withDeps || withDependents {
+		if sl, err = expandStackSelection(logOut, dc, sl, kv, withDeps, withDependents); err != nil {
+			return err
 		}
 	}
 
-	// Check all stacks in the config file if it's cyclic
-	fullList := dc.GetStackList(nil)
-	isCyclic, _, err := ifCircularStacks(dc, fullList, kv)
+	sorted, err := sortStacks(dc, sl, kv)
 	if err != nil {
 		return err
-	} else if isCyclic {
-		return errors.New("The stack(s) in the stack list contains circular dependency.")
 	}
 
-	// Check if stacks are cyclic and sort it.
-	_, sorted, _ := ifCircularStacks(dc, sl, kv)
-
 	stack := ctlaws.NewStack(cf.New(ctlaws.AWSSess))
 
-	for _, v := range sorted {
+	if dry {
+		return dryRunStacks(dc, kv, sl, sorted, stack)
+	}
+
+	if len(planOut) > 0 {
+		return planOutStacks(dc, kv, sl, sorted, stack, planOut)
+	}
+
+	// A parameter file of "aws cloudformation deploy"
+	// is for one stack only.
+	if paramOnly && output != "yaml" {
+		var withParams []string
+		for _, name := range sorted {
+			if stc, ok := sl[name]; ok && stc.HasParams() {
+				withParams = append(withParams, name)
+			}
+		}
+
+		if len(withParams) > 1 {
+			return errors.New(fmt.Sprintf("--%s with json output only supports one stack but found stacks with parameters: %s. Select one by --%s or use '-o yaml'", CMD_STACK_DEPLOY_PARAM_ONLY, strings.Join(withParams, ", "), CMD_STACK_DEPLOY_STACK))
+		}
+	}
+
+	for _, name := range sorted {
 		// Don't process if it's not in given stack list as it
 		// may contains stacks from other references such via
 		// tpl function.
-		stc, ok := sl[v.Value.Id()]
+		stc, ok := sl[name]
 		if !ok {
 			continue
 		}
 
 		// Line seperator for each stack
-		fmt.Println("")
-
-		// Load template
-		dat, err := ioutil.ReadFile(dc.GetTplPath(stc.Tpl))
-		if err != nil {
-			return err
-		}
-
-		// Dry run
-		if dry {
-			if _, err := stack.ValidateTemplate(dat, ""); err != nil {
-				return err
-			} else {
-				utils.InfoPrint(
-					fmt.Sprintf(
-						"[ stack | validate ] %s\t%s",
-						stc.Name,
-						"ok",
-					),
-				)
-			}
-
-			continue
+		if !paramOnly {
+			fmt.Println("")
 		}
 
 		// If there is parameters provided
-		params := make(map[string]string)
+		params := conf.NewStackParams()
 		// If no parameters and only parsing parameters
-		if len(stc.Param) <= 0 && paramOnly {
+		if !stc.HasParams() && paramOnly {
 			continue
 		}
 
-		if len(stc.Param) > 0 {
-			// Get Parameters.
-			paramTpl, err := utils.LoadYaml(dc.GetParamPath(stc.Param))
+		var err error
+		if stc.HasParams() {
+			params, err = renderStackParams(dc, stc, kv)
 			if err != nil {
 				return err
 			}
+		}
 
-			// Parse parameter template.
-			paramBytes, err := parser.Parse(string(paramTpl), kv, dc)
-			if err != nil {
-				return err
-			}
+		tags := stackTags(stc, params)
 
-			if err := yaml.Unmarshal(paramBytes, &params); err != nil {
-				return err
-			}
+		// If only parsing parameters
+		if paramOnly {
+			if output == "yaml" {
+				paramBytes, err := yaml.Marshal(params.Parameters)
+				if err != nil {
+					return err
+				}
 
-			// If only parsing parameters
-			if paramOnly {
-				if output == "yaml" {
-					utils.InfoPrint("------")
-					utils.InfoPrint(string(paramBytes))
-				} else {
-					pList := stack.ParamSlice(params)
-					if pListJson, err := json.MarshalIndent(pList, "  ", "  "); err != nil {
-						return err
-					} else {
-						utils.InfoPrint(string(pListJson))
-					}
+				utils.InfoPrint("------")
+				utils.InfoPrint(string(paramBytes))
+			} else {
+				// CodePipeline template configuration
+				// accepted by "aws cloudformation deploy"
+				config := params.PipelineConfig()
+				if len(tags) > 0 {
+					config[conf.PARAMS_KEY_TAGS] = tags
 				}
 
-				continue
+				if pJson, err := json.MarshalIndent(config, "", "  "); err != nil {
+					return err
+				} else {
+					utils.InfoPrint(string(pJson))
+				}
 			}
 
+			continue
+		}
+
+		// Load template. It isn't needed for only parsing
+		// parameters, so nested templates aren't uploaded.
+		dat, err := parser.LoadTemplate(stc.Tpl, stc.IsTemplated(), stc.Values(kv), dc)
+		if err != nil {
+			return err
+		}
+
+		opts := &ctlaws.StackOptions{
+			UsePreviousValue: params.UsePreviousValue,
+			StackPolicy:      params.StackPolicy,
 		}
 
 		// Create or update the stack.
 		var waiterType string
 		var isCreation bool
 		if stack.Exist(stc.Name) {
-			_, err = stack.UpdateStack(stc.Name, params, stc.Tags, dat, "")
+			_, err = stack.UpdateStack(stc.Name, params.Parameters, tags, dat, "", opts)
 			waiterType = ctlaws.StackWaiterTypeUpdate
 		} else {
 			isCreation = true
-			_, err = stack.CreateStack(stc.Name, params, stc.Tags, dat, "")
+			_, err = stack.CreateStack(stc.Name, params.Parameters, tags, dat, "", opts)
 			waiterType = ctlaws.StackWaiterTypeCreate
 		}
 
@@ -404,11 +676,26 @@ func deployStacks(f, env, named, tags string, vaultPass []string, dry, paramOnly
 			return err
 		}
 
+		// Make sure downstream stacks see the fresh outputs.
+		funcs.InvalidateStackOutputs(stc.Name)
 	}
 
 	return nil
 }
 
+// Return tags of a stack. Tags from parameter
+// files override the ones in the stack config.
+func stackTags(sc *conf.StackConfig, params *conf.StackParams) map[string]string {
+	tags := make(map[string]string)
+	for _, t := range []map[string]string{sc.Tags, params.Tags} {
+		for k, v := range t {
+			tags[k] = v
+		}
+	}
+
+	return tags
+}
+
 // Excluding some AWS errors.
 func excludeErrorByMessage(err error, name string) bool {
 	// No update error
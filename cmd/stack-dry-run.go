@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	ctlaws "github.com/liangrog/cfctl/pkg/aws"
+	"github.com/liangrog/cfctl/pkg/conf"
+	"github.com/liangrog/cfctl/pkg/template/cfn"
+	"github.com/liangrog/cfctl/pkg/template/parser"
+	"github.com/liangrog/cfctl/pkg/utils"
+)
+
+// Dry run deployment of sorted stacks. Templates and parameters
+// are rendered the same as deploying except that the templates of
+// "tpl" aren't uploaded and stack outputs are only looked up. Then
+// templates are validated by AWS and the offline rules, parameters
+// against the templates, and a plan of create, update or no-op is
+// printed for each stack. Problems of all stacks are reported
+// together.
+func dryRunStacks(dc *conf.DeployConfig, kv map[string]interface{}, sl map[string]*conf.StackConfig, sorted []string, stack *ctlaws.Stack) error {
+	live, err := describeStacksByName(stack)
+	if err != nil {
+		return err
+	}
+
+	dr := parser.NewDryRun(stackNames(live))
+	parser.EnableDryRun(dr)
+	defer parser.EnableDryRun(nil)
+
+	var errs []*stackError
+	counts := make(map[string]int)
+	linted := make(map[string]bool)
+	for _, name := range sorted {
+		// Stacks not in given stack list are only dependencies
+		sc, ok := sl[name]
+		if !ok {
+			continue
+		}
+
+		fmt.Println("")
+
+		stackErrs, plan := dryRunStack(stack, dc, sc, kv, dr, live[name], sl)
+
+		// Templates of "tpl" rendered for the stack
+		var nested []string
+		for p := range dr.Templates {
+			if !linted[p] {
+				nested = append(nested, p)
+			}
+		}
+
+		sort.Strings(nested)
+
+		for _, p := range nested {
+			linted[p] = true
+			stackErrs = append(stackErrs, lintTemplate(sc, dc.GetTplPath(p), dr.Templates[p], false)...)
+		}
+
+		dr.Deployed[name] = true
+
+		for _, e := range stackErrs {
+			utils.StdoutError(fmt.Sprintf("[ stack | validate ] %s\t%s\n", sc.Name, e))
+		}
+
+		if len(stackErrs) == 0 {
+			utils.InfoPrint(fmt.Sprintf("[ stack | validate ] %s\t%s", sc.Name, "ok"))
+		}
+
+		errs = append(errs, stackErrs...)
+
+		if plan != nil {
+			counts[plan.Action]++
+			utils.InfoPrint(fmt.Sprintf("[ stack | plan ] %s", plan))
+		}
+	}
+
+	fmt.Println("")
+	utils.InfoPrint(fmt.Sprintf(
+		"Plan: %d to create, %d to update, %d unchanged",
+		counts[stackActionCreate],
+		counts[stackActionUpdate],
+		counts[stackActionNoop],
+	))
+
+	if len(errs) > 0 {
+		return stackErrorsSummary(errs)
+	}
+
+	return nil
+}
+
+// Dry run a stack. The plan is nil if the stack can't be rendered.
+func dryRunStack(stack *ctlaws.Stack, dc *conf.DeployConfig, sc *conf.StackConfig, kv map[string]interface{}, dr *parser.DryRun, live *cf.Stack, sl map[string]*conf.StackConfig) ([]*stackError, *stackPlan) {
+	var errs []*stackError
+	problem := func(msg string) {
+		errs = append(errs, &stackError{Stack: sc.Name, Message: msg})
+	}
+
+	// Stacks depended on but not deployed in the run must exist
+	for _, d := range sc.DependsOn {
+		dsc := dc.GetStackConfigByName(d)
+		if _, ok := sl[d]; !ok && dsc != nil && dsc.IsEnabled() && !dr.Existing[d] {
+			problem(fmt.Sprintf("Stack %s depended on doesn't exist and isn't deployed earlier in this run.", d))
+		}
+	}
+
+	if live != nil {
+		if msg := stackStatusProblem(aws.StringValue(live.StackStatus)); len(msg) > 0 {
+			problem(msg)
+		}
+	}
+
+	dat, err := parser.LoadTemplate(sc.Tpl, sc.IsTemplated(), sc.Values(kv), dc)
+	if err != nil {
+		problem(fmt.Sprintf("Failed to load template: %s", err))
+		return errs, nil
+	}
+
+	if _, err := stack.ValidateTemplate(dat, ""); err != nil {
+		problem(fmt.Sprintf("Template is invalid: %s", err))
+	}
+
+	errs = append(errs, lintTemplate(sc, dc.GetTplPath(sc.Tpl), dat, true)...)
+
+	params := conf.NewStackParams()
+	if sc.HasParams() {
+		if params, err = renderStackParams(dc, sc, kv); err != nil {
+			problem(fmt.Sprintf("Failed to render parameters: %s", err))
+			return errs, nil
+		}
+	}
+
+	// Parse errors are reported by the rules already
+	tpl, err := cfn.Parse(dat)
+	if err == nil {
+		for _, e := range tpl.ValidateParams(params.Parameters, params.UsePreviousValue) {
+			// Outputs not known yet can't be validated
+			if v, ok := params.Parameters[e.Parameter]; ok && dr.IsUnknown(v) {
+				continue
+			}
+
+			errs = append(errs, &stackError{Stack: sc.Name, Parameter: e.Parameter, Message: e.Message})
+		}
+	}
+
+	plan, err := planStack(stack, sc.Name, live, dat, tpl, params, stackTags(sc, params))
+	if err != nil {
+		problem(fmt.Sprintf("Failed to plan: %s", err))
+		return errs, nil
+	}
+
+	return errs, plan
+}
+
+// Check a template by the offline rules. Errors are
+// returned as problems and warnings are printed. Stack
+// templates are sent inline, nested ones from S3.
+func lintTemplate(sc *conf.StackConfig, path string, dat []byte, inline bool) []*stackError {
+	lint := cfn.Lint
+	if inline {
+		lint = cfn.LintInline
+	}
+
+	var errs []*stackError
+	for _, f := range lint(displayPath(path), dat) {
+		if f.IsError() {
+			errs = append(errs, &stackError{Stack: sc.Name, Message: f.String()})
+		} else {
+			utils.StdoutWarn(fmt.Sprintf("[ stack | validate ] %s\t%s\n", sc.Name, f))
+		}
+	}
+
+	return errs
+}
@@ -43,6 +43,7 @@ func init() {
 }
 
 func addFlagsStackGet(cmd *cobra.Command) {
+	addFlagEnv(cmd)
 	cmd.Flags().String(CMD_STACK_GET_NAME, "", "get stack's details for given stack name. Multiple stack names can be given and seperated by comma, e.g 'stack-a,stack-b'")
 }
 
@@ -56,6 +57,7 @@ func getCmdStackGet() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			err := stackGet(
 				cmd.Flags().Lookup(CMD_STACK_DEPLOY_FILE).Value.String(),
+				cmd.Flags().Lookup(CMD_STACK_DEPLOY_ENV).Value.String(),
 				cmd.Flags().Lookup(CMD_ROOT_OUTPUT).Value.String(),
 				cmd.Flags().Lookup(CMD_STACK_GET_NAME).Value.String(),
 				cmd.Flags().Lookup(CMD_STACK_DEPLOY_TAGS).Value.String(),
@@ -71,11 +73,12 @@ func getCmdStackGet() *cobra.Command {
 }
 
 // Get stacks
-func stackGet(f, format, stackNames, tags string) error {
+func stackGet(f, env string, format, stackNames, tags string) error {
 	stack := ctlaws.NewStack(cf.New(ctlaws.AWSSess))
 
-	// Load deploy configuration file.
-	dc, err := conf.NewDeployConfig(f)
+	// Load deploy configuration file. Environment
+	// values aren't needed to find the stacks.
+	dc, err := conf.NewDeployConfigWithoutValues(f, env)
 	if err != nil {
 		return err
 	}
@@ -90,7 +93,7 @@ func stackGet(f, format, stackNames, tags string) error {
 		filters["tag"] = tags
 	}
 
-	sl := dc.GetStackList(filters)
+	sl := dc.GetStacks(filters)
 
 	if len(sl) == 0 {
 		return errors.New("No stack found.")
@@ -98,7 +101,8 @@ func stackGet(f, format, stackNames, tags string) error {
 
 	// If stack name given
 	var errMsg []string
-	for k, _ := range sl {
+	for _, sc := range sl {
+		k := sc.Name
 		if !stack.Exist(k) {
 			errMsg = append(errMsg, utils.MsgFormat(fmt.Sprintf("Failed to find stack %s\n", k), utils.MessageTypeError))
 			continue
@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	ctlaws "github.com/liangrog/cfctl/pkg/aws"
+	"github.com/liangrog/cfctl/pkg/graph"
+	"github.com/liangrog/cfctl/pkg/utils"
+	"github.com/liangrog/cfctl/pkg/utils/i18n"
+	"github.com/liangrog/cfctl/pkg/utils/templates"
+	"github.com/spf13/cobra"
+)
+
+// Stack graph formats
+const (
+	graphFormatDot     = "dot"
+	graphFormatMermaid = "mermaid"
+)
+
+// Stack graph colours
+const (
+	graphColourComplete   = "#9be9a8"
+	graphColourInProgress = "#fff3a3"
+	graphColourFailed     = "#ff9c9c"
+	graphColourNotExist   = "#e0e0e0"
+	graphColourUndefined  = "#ff0000"
+)
+
+var (
+	stackGraphShort = i18n.T("Show stack dependency graph")
+
+	stackGraphLong = templates.LongDesc(i18n.T(`
+		Show the stack dependency graph inferred from the stack file and the
+		parameter files, the same graph used for deployment ordering. It
+		doesn't call AWS unless '--status' is given.
+
+		Stacks referenced by 'stackOutput' but not defined in the stack file
+		are drawn with red dashed border, and the ones disabled for the
+		environment with grey dashed border. With '--status', stacks are coloured
+		by their live status: green for complete, yellow for in progress, red
+		for failed or rolled back and grey for not existing.
+
+		The graph is drawn in DOT or Mermaid by '--format'. If '--output' is
+		given, the stacks and their dependencies are printed in JSON or YAML
+		instead.`))
+
+	stackGraphExample = templates.Examples(i18n.T(`
+		# Show stack graph in DOT and render it by Graphviz
+		$ cfctl stack graph --env production | dot -Tpng -o stacks.png
+
+		# Show stack graph in Mermaid with live stack status
+		$ cfctl stack graph --env production --format mermaid --status
+
+		# Show stack graph in JSON
+		$ cfctl stack graph --env production -o json`))
+)
+
+// Register sub commands
+func init() {
+	cmd := getCmdStackGraph()
+	addFlagsStackGraph(cmd)
+
+	CmdStack.AddCommand(cmd)
+}
+
+func addFlagsStackGraph(cmd *cobra.Command) {
+	addFlagsEnvValues(cmd)
+	cmd.Flags().String(CMD_STACK_GRAPH_FORMAT, graphFormatDot, "graph format. One of 'dot' or 'mermaid'. Ignored if '--output' is given")
+	cmd.Flags().BoolP(CMD_STACK_GRAPH_STATUS, "", false, "colour stacks by their live status")
+}
+
+// cmd: stack graph
+func getCmdStackGraph() *cobra.Command {
+	return &cobra.Command{
+		Use:     "graph",
+		Short:   stackGraphShort,
+		Long:    stackGraphLong,
+		Example: fmt.Sprintf(stackGraphExample),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			status, _ := cmd.Flags().GetBool(CMD_STACK_GRAPH_STATUS)
+
+			// Data output only if asked for explicitly
+			var output string
+			if cmd.Flags().Changed(CMD_ROOT_OUTPUT) {
+				output = cmd.Flags().Lookup(CMD_ROOT_OUTPUT).Value.String()
+			}
+
+			passes, err := getVaultPasswords(cmd)
+			if err == nil {
+				err = stackGraphShow(
+					cmd.Flags().Lookup(CMD_STACK_DEPLOY_FILE).Value.String(),
+					cmd.Flags().Lookup(CMD_STACK_DEPLOY_ENV).Value.String(),
+					passes,
+					getValueOverrides(cmd),
+					cmd.Flags().Lookup(CMD_STACK_GRAPH_FORMAT).Value.String(),
+					output,
+					status,
+				)
+			}
+
+			silenceUsageOnError(cmd, err)
+
+			return err
+		},
+	}
+}
+
+// A stack in the graph
+type stackGraphNode struct {
+	Name      string   `json:"name" yaml:"name"`
+	Defined   bool     `json:"defined" yaml:"defined"`
+	Disabled  bool     `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	Status    string   `json:"status,omitempty" yaml:"status,omitempty"`
+	DependsOn []string `json:"dependsOn,omitempty" yaml:"dependsOn,omitempty"`
+}
+
+// Show stack dependency graph. If output is given, the
+// graph is printed in the output type instead of format.
+func stackGraphShow(f, env string, vaultPass []string, ov *valueOverrides, format, output string, status bool) error {
+	switch format {
+	case graphFormatDot, graphFormatMermaid:
+	default:
+		return errors.New(fmt.Sprintf("Unsupported graph format %s", format))
+	}
+
+	dc, kv, err := loadDeployConfig(f, env, vaultPass, ov)
+	if err != nil {
+		return err
+	}
+
+	g, err := stackGraph(dc, dc.GetStackList(nil), kv)
+	if err != nil {
+		return err
+	}
+
+	statuses := make(map[string]string)
+	if status {
+		stacks, err := ctlaws.NewStack(cf.New(ctlaws.AWSSess)).DescribeStacks()
+		if err != nil {
+			return err
+		}
+
+		for _, s := range stacks {
+			statuses[aws.StringValue(s.StackName)] = aws.StringValue(s.StackStatus)
+		}
+	}
+
+	var nodes []*stackGraphNode
+	styles := make(map[string]*graph.Style)
+	for _, n := range g.Nodes() {
+		sc := dc.GetStackConfigByName(n)
+		node := &stackGraphNode{
+			Name:      n,
+			Defined:   sc != nil,
+			Disabled:  sc != nil && !sc.IsEnabled(),
+			Status:    statuses[n],
+			DependsOn: g.Dependencies(n),
+		}
+
+		nodes = append(nodes, node)
+
+		style := &graph.Style{Label: n}
+		if status {
+			style.Colour = statusColour(node.Status)
+			if len(node.Status) > 0 {
+				style.Label = fmt.Sprintf("%s (%s)", n, node.Status)
+			}
+		}
+
+		switch {
+		case !node.Defined:
+			style.Label = fmt.Sprintf("%s (undefined)", style.Label)
+			style.Border = graphColourUndefined
+			style.Dashed = true
+		case node.Disabled:
+			style.Label = fmt.Sprintf("%s (disabled)", style.Label)
+			style.Border = graphColourNotExist
+			style.Dashed = true
+		}
+
+		styles[n] = style
+	}
+
+	switch {
+	case len(output) > 0:
+		return utils.Print(utils.FormatType(output), nodes)
+	case format == graphFormatMermaid:
+		fmt.Print(g.Mermaid(styles))
+	default:
+		fmt.Print(g.Dot("stacks", styles))
+	}
+
+	return nil
+}
+
+// Return colour for given stack status
+func statusColour(status string) string {
+	switch {
+	case len(status) == 0:
+		return graphColourNotExist
+	case strings.HasSuffix(status, "_IN_PROGRESS"):
+		return graphColourInProgress
+	case strings.HasSuffix(status, "_FAILED"), strings.Contains(status, "ROLLBACK"):
+		return graphColourFailed
+	}
+
+	return graphColourComplete
+}
@@ -0,0 +1,349 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	ctlaws "github.com/liangrog/cfctl/pkg/aws"
+	"github.com/liangrog/cfctl/pkg/conf"
+	"github.com/liangrog/cfctl/pkg/template/cfn"
+	"github.com/liangrog/cfctl/pkg/template/parser"
+	"github.com/liangrog/cfctl/pkg/utils"
+	"github.com/liangrog/cfctl/pkg/utils/i18n"
+	"github.com/liangrog/cfctl/pkg/utils/templates"
+	"github.com/spf13/cobra"
+)
+
+var (
+	stackPlanShort = i18n.T("Show what would change by deploying stacks")
+
+	stackPlanLong = templates.LongDesc(i18n.T(`
+		Compare the configured stacks with the deployed ones without creating
+		change sets. For each stack, it shows whether the stack exists, its
+		status, the action of deploying it (create, update or no-op), and
+		the differences of the template, the rendered parameters and the
+		tags from the deployed stack.
+
+		Templates are normalised before comparing, so differences of
+		format such as JSON or YAML, key order, comments and short or long
+		form intrinsic functions are ignored. Templates of 'tpl' are
+		rendered but not uploaded. Values of NoEcho parameters aren't
+		returned by AWS so they aren't compared.
+
+		Stacks in '*_IN_PROGRESS', '*_FAILED' or 'ROLLBACK_COMPLETE' state
+		are reported with the problem and the command exits with an error.`))
+
+	stackPlanExample = templates.Examples(i18n.T(`
+		# Show the plan of all stacks for production
+		$ cfctl stack plan --env production --vault-password-file path/to/password/file
+
+		# Show the plan of particular stacks with template differences in YAML
+		$ cfctl stack plan --env production --stack stack1,stack2 -o yaml`))
+)
+
+// Register sub commands
+func init() {
+	cmd := getCmdStackPlan()
+	addFlagsStackPlan(cmd)
+
+	CmdStack.AddCommand(cmd)
+}
+
+func addFlagsStackPlan(cmd *cobra.Command) {
+	addFlagsEnvValues(cmd)
+	cmd.Flags().String(CMD_STACK_DEPLOY_STACK, "", "specify what stacks to plan. If multiple stacks, use comma delimiter. For example: stackA,stackB")
+}
+
+// cmd: stack plan
+func getCmdStackPlan() *cobra.Command {
+	return &cobra.Command{
+		Use:     "plan",
+		Short:   stackPlanShort,
+		Long:    stackPlanLong,
+		Example: fmt.Sprintf(stackPlanExample),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			passes, err := getVaultPasswords(cmd)
+			if err == nil {
+				err = stackPlanShow(
+					cmd.Flags().Lookup(CMD_STACK_DEPLOY_FILE).Value.String(),
+					cmd.Flags().Lookup(CMD_STACK_DEPLOY_ENV).Value.String(),
+					passes,
+					getValueOverrides(cmd),
+					cmd.Flags().Lookup(CMD_ROOT_OUTPUT).Value.String(),
+					cmd.Flags().Lookup(CMD_STACK_DEPLOY_STACK).Value.String(),
+					cmd.Flags().Lookup(CMD_STACK_DEPLOY_TAGS).Value.String(),
+				)
+			}
+
+			silenceUsageOnError(cmd, err)
+
+			return err
+		},
+	}
+}
+
+// Deploy actions of a stack
+const (
+	stackActionCreate = "create"
+	stackActionUpdate = "update"
+	stackActionNoop   = "no-op"
+)
+
+// Value of NoEcho parameters returned by AWS
+const noEchoValue = "****"
+
+// Planned change of a stack against the deployed one
+type stackPlan struct {
+	Name         string            `json:"name" yaml:"name"`
+	Action       string            `json:"action" yaml:"action"`
+	Exists       bool              `json:"exists" yaml:"exists"`
+	Status       string            `json:"status,omitempty" yaml:"status,omitempty"`
+	Problem      string            `json:"problem,omitempty" yaml:"problem,omitempty"`
+	Template     bool              `json:"template,omitempty" yaml:"template,omitempty"`
+	TemplateDiff string            `json:"templateDiff,omitempty" yaml:"templateDiff,omitempty"`
+	Parameters   []*conf.ValueDiff `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	Tags         []*conf.ValueDiff `json:"tags,omitempty" yaml:"tags,omitempty"`
+}
+
+// Describe the changes in one line
+func (p *stackPlan) String() string {
+	s := fmt.Sprintf("name: %s\taction: %s", p.Name, p.Action)
+	if p.Template {
+		s += "\ttemplate: changed"
+	}
+
+	for _, d := range []struct {
+		name  string
+		diffs []*conf.ValueDiff
+	}{{"parameters", p.Parameters}, {"tags", p.Tags}} {
+		if len(d.diffs) == 0 {
+			continue
+		}
+
+		var keys []string
+		for _, v := range d.diffs {
+			keys = append(keys, v.Key)
+		}
+
+		s += fmt.Sprintf("\t%s: %s", d.name, strings.Join(keys, ", "))
+	}
+
+	return s
+}
+
+// Show the plan of stacks
+func stackPlanShow(f, env string, vaultPass []string, ov *valueOverrides, format, named, tags string) error {
+	dc, kv, err := loadDeployConfig(f, env, vaultPass, ov)
+	if err != nil {
+		return err
+	}
+
+	filters := make(map[string]string)
+	if len(named) > 0 {
+		filters["name"] = named
+	}
+
+	if len(tags) > 0 {
+		filters["tag"] = tags
+	}
+
+	sl := dc.GetStacks(filters)
+	if len(sl) == 0 {
+		return errors.New("No stack found.")
+	}
+
+	stack := ctlaws.NewStack(cf.New(ctlaws.AWSSess))
+
+	live, err := describeStacksByName(stack)
+	if err != nil {
+		return err
+	}
+
+	dr := parser.NewDryRun(stackNames(live))
+	parser.EnableDryRun(dr)
+	defer parser.EnableDryRun(nil)
+
+	// Outputs of the configured stacks not
+	// deployed yet are known after deploying
+	for _, sc := range dc.GetStacks(nil) {
+		dr.Deployed[sc.Name] = true
+	}
+
+	var plans []*stackPlan
+	var problems int
+	for _, sc := range sl {
+		plan, err := planStackConfig(stack, dc, sc, kv, live[sc.Name])
+		if err != nil {
+			plan = &stackPlan{
+				Name:    sc.Name,
+				Exists:  live[sc.Name] != nil,
+				Problem: err.Error(),
+			}
+
+			if plan.Exists {
+				plan.Status = aws.StringValue(live[sc.Name].StackStatus)
+			}
+		}
+
+		if len(plan.Problem) > 0 {
+			problems++
+		}
+
+		plans = append(plans, plan)
+	}
+
+	if err := utils.Print(utils.FormatType(format), plans); err != nil {
+		return err
+	}
+
+	if problems > 0 {
+		return errors.New(fmt.Sprintf("Stacks have problems: %d of %d stacks", problems, len(plans)))
+	}
+
+	return nil
+}
+
+// Plan a stack by rendering its template and parameters
+// and comparing them with the deployed stack.
+func planStackConfig(stack *ctlaws.Stack, dc *conf.DeployConfig, sc *conf.StackConfig, kv map[string]interface{}, live *cf.Stack) (*stackPlan, error) {
+	dat, err := parser.LoadTemplate(sc.Tpl, sc.IsTemplated(), sc.Values(kv), dc)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to load template: %s", err))
+	}
+
+	params := conf.NewStackParams()
+	if sc.HasParams() {
+		if params, err = renderStackParams(dc, sc, kv); err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to render parameters: %s", err))
+		}
+	}
+
+	// Without parsed template, defaults of parameters are unknown
+	tpl, _ := cfn.Parse(dat)
+
+	return planStack(stack, sc.Name, live, dat, tpl, params, stackTags(sc, params))
+}
+
+// Describe all deployed stacks keyed by name
+func describeStacksByName(stack *ctlaws.Stack) (map[string]*cf.Stack, error) {
+	stacks, err := stack.DescribeStacks()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]*cf.Stack)
+	for _, s := range stacks {
+		result[aws.StringValue(s.StackName)] = s
+	}
+
+	return result, nil
+}
+
+// Return the names of given stacks
+func stackNames(stacks map[string]*cf.Stack) []string {
+	var names []string
+	for n := range stacks {
+		names = append(names, n)
+	}
+
+	return names
+}
+
+// Plan the deployment of a stack by comparing the local template,
+// parameters and tags with the deployed stack. The template may be
+// nil if it can't be parsed. Values of NoEcho parameters aren't
+// returned by AWS so they can't be compared.
+func planStack(stack *ctlaws.Stack, name string, live *cf.Stack, dat []byte, tpl *cfn.Template, params *conf.StackParams, tags map[string]string) (*stackPlan, error) {
+	plan := &stackPlan{Name: name, Action: stackActionCreate}
+	if live == nil {
+		return plan, nil
+	}
+
+	plan.Exists = true
+	plan.Status = aws.StringValue(live.StackStatus)
+	plan.Problem = stackStatusProblem(plan.Status)
+
+	body, err := stack.GetTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := cfn.Diff([]byte(body), dat, fmt.Sprintf("%s (deployed)", name), fmt.Sprintf("%s (local)", name))
+	if err != nil {
+		return nil, err
+	}
+
+	plan.Template = len(diff) > 0
+	plan.TemplateDiff = diff
+
+	liveParams := make(map[string]interface{})
+	for _, p := range live.Parameters {
+		liveParams[aws.StringValue(p.ParameterKey)] = aws.StringValue(p.ParameterValue)
+	}
+
+	// Parameters not given take their defaults
+	localParams := make(map[string]interface{})
+	if tpl != nil {
+		for _, p := range tpl.Parameters {
+			if p.Default != nil {
+				localParams[p.Name] = *p.Default
+			}
+		}
+	}
+
+	for k, v := range params.Parameters {
+		localParams[k] = v
+	}
+
+	for _, k := range params.UsePreviousValue {
+		if v, ok := liveParams[k]; ok {
+			localParams[k] = v
+		}
+	}
+
+	for k, v := range liveParams {
+		if v == noEchoValue {
+			delete(liveParams, k)
+			delete(localParams, k)
+		}
+	}
+
+	plan.Parameters = conf.DiffValues(liveParams, localParams)
+
+	liveTags := make(map[string]interface{})
+	for _, t := range live.Tags {
+		liveTags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+
+	localTags := make(map[string]interface{})
+	for k, v := range tags {
+		localTags[k] = v
+	}
+
+	plan.Tags = conf.DiffValues(liveTags, localTags)
+
+	plan.Action = stackActionNoop
+	if plan.Template || len(plan.Parameters) > 0 || len(plan.Tags) > 0 {
+		plan.Action = stackActionUpdate
+	}
+
+	return plan, nil
+}
+
+// Return the problem of deploying a stack in given
+// status, empty if the stack can be deployed.
+func stackStatusProblem(status string) string {
+	switch {
+	case strings.HasSuffix(status, "_IN_PROGRESS"):
+		return fmt.Sprintf("Stack is in %s state, it can't be deployed until the operation completes.", status)
+	case status == cf.StackStatusRollbackComplete:
+		return fmt.Sprintf("Stack is in %s state, it must be deleted before deploying again.", status)
+	case strings.HasSuffix(status, "_FAILED"):
+		return fmt.Sprintf("Stack is in %s state, it must be fixed before deploying again.", status)
+	}
+
+	return ""
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/liangrog/cfctl/pkg/conf"
+	"github.com/liangrog/cfctl/pkg/template/cfn"
+	"github.com/liangrog/cfctl/pkg/template/parser"
+	"github.com/liangrog/cfctl/pkg/utils"
+	"github.com/liangrog/cfctl/pkg/utils/i18n"
+	"github.com/liangrog/cfctl/pkg/utils/templates"
+	"github.com/spf13/cobra"
+)
+
+var (
+	stackValidateShort = i18n.T("Validate stack parameters against their templates")
+
+	stackValidateLong = templates.LongDesc(i18n.T(`
+		Validate the rendered parameters of stacks against the Parameters
+		section of their templates without creating or updating any stack.
+		It's local, nested templates aren't uploaded and stack outputs
+		aren't looked up, so parameters using them aren't validated.
+
+		It reports parameters not defined in the template, required
+		parameters (without Default) not given, and values violating
+		AllowedValues, AllowedPattern, MinLength, MaxLength, MinValue,
+		MaxValue or the format of types such as 'List<Number>' and
+		'AWS::EC2::VPC::Id'. Errors of all stacks are reported together.`))
+
+	stackValidateExample = templates.Examples(i18n.T(`
+		# Validate parameters of all stacks for production
+		$ cfctl stack validate --env production --vault-password-file path/to/password/file
+
+		# Validate parameters of particular stacks
+		$ cfctl stack validate --env production --stack stack1,stack2`))
+)
+
+// Register sub commands
+func init() {
+	cmd := getCmdStackValidate()
+	addFlagsStackValidate(cmd)
+
+	CmdStack.AddCommand(cmd)
+}
+
+func addFlagsStackValidate(cmd *cobra.Command) {
+	addFlagsEnvValues(cmd)
+	cmd.Flags().String(CMD_STACK_DEPLOY_STACK, "", "specify what stacks to validate. If multiple stacks, use comma delimiter. For example: stackA,stackB")
+}
+
+// cmd: stack validate
+func getCmdStackValidate() *cobra.Command {
+	return &cobra.Command{
+		Use:     "validate",
+		Short:   stackValidateShort,
+		Long:    stackValidateLong,
+		Example: fmt.Sprintf(stackValidateExample),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			passes, err := getVaultPasswords(cmd)
+			if err == nil {
+				err = stackValidate(
+					cmd.Flags().Lookup(CMD_STACK_DEPLOY_FILE).Value.String(),
+					cmd.Flags().Lookup(CMD_STACK_DEPLOY_ENV).Value.String(),
+					passes,
+					getValueOverrides(cmd),
+					cmd.Flags().Lookup(CMD_ROOT_OUTPUT).Value.String(),
+					cmd.Flags().Lookup(CMD_STACK_DEPLOY_STACK).Value.String(),
+					cmd.Flags().Lookup(CMD_STACK_DEPLOY_TAGS).Value.String(),
+				)
+			}
+
+			silenceUsageOnError(cmd, err)
+
+			return err
+		},
+	}
+}
+
+// Problem found in a stack
+type stackError struct {
+	Stack     string `json:"stack" yaml:"stack"`
+	Parameter string `json:"parameter,omitempty" yaml:"parameter,omitempty"`
+	Message   string `json:"message" yaml:"message"`
+}
+
+// Describe the problem without the stack name
+func (e *stackError) String() string {
+	if len(e.Parameter) > 0 {
+		return fmt.Sprintf("parameter %s %s", e.Parameter, e.Message)
+	}
+
+	return e.Message
+}
+
+// Validate stacks
+func stackValidate(f, env string, vaultPass []string, ov *valueOverrides, format, named, tags string) error {
+	dc, kv, err := loadDeployConfig(f, env, vaultPass, ov)
+	if err != nil {
+		return err
+	}
+
+	filters := make(map[string]string)
+	if len(named) > 0 {
+		filters["name"] = named
+	}
+
+	if len(tags) > 0 {
+		filters["tag"] = tags
+	}
+
+	sl := dc.GetStacks(filters)
+	if len(sl) == 0 {
+		return errors.New("No stack found.")
+	}
+
+	// Render locally without uploading nested
+	// templates or looking up stack outputs.
+	dr := parser.NewDryRun(nil)
+	dr.Offline = true
+	parser.EnableDryRun(dr)
+	defer parser.EnableDryRun(nil)
+
+	var errs []*stackError
+	for _, sc := range sl {
+		errs = append(errs, validateStackParams(dc, sc, kv, dr)...)
+	}
+
+	if len(errs) == 0 {
+		return utils.Print(utils.FormatType(format), "No error found")
+	}
+
+	if err := utils.Print(utils.FormatType(format), errs); err != nil {
+		return err
+	}
+
+	return stackErrorsSummary(errs)
+}
+
+// Validate rendered parameters of a stack against its template
+// locally. Failures of loading the template or rendering the
+// parameters are returned as problems of the stack as well.
+// Values of stack outputs are unknown so they aren't validated.
+func validateStackParams(dc *conf.DeployConfig, sc *conf.StackConfig, kv map[string]interface{}, dr *parser.DryRun) []*stackError {
+	dat, err := parser.LoadTemplate(sc.Tpl, sc.IsTemplated(), sc.Values(kv), dc)
+	if err != nil {
+		return []*stackError{{Stack: sc.Name, Message: fmt.Sprintf("Failed to load template: %s", err)}}
+	}
+
+	tpl, err := cfn.Parse(dat)
+	if err != nil {
+		return []*stackError{{Stack: sc.Name, Message: fmt.Sprintf("Failed to parse template %s: %s", sc.Tpl, err)}}
+	}
+
+	params, err := renderStackParams(dc, sc, kv)
+	if err != nil {
+		return []*stackError{{Stack: sc.Name, Message: fmt.Sprintf("Failed to render parameters: %s", err)}}
+	}
+
+	var errs []*stackError
+	for _, e := range tpl.ValidateParams(params.Parameters, params.UsePreviousValue) {
+		if v, ok := params.Parameters[e.Parameter]; ok && dr.IsUnknown(v) {
+			continue
+		}
+
+		errs = append(errs, &stackError{Stack: sc.Name, Parameter: e.Parameter, Message: e.Message})
+	}
+
+	return errs
+}
+
+// Return error summarising the problems of stacks
+func stackErrorsSummary(errs []*stackError) error {
+	var stacks []string
+	for _, e := range errs {
+		if !utils.InSlice(stacks, e.Stack) {
+			stacks = append(stacks, e.Stack)
+		}
+	}
+
+	return errors.New(fmt.Sprintf("Stacks are invalid: %d errors in %d stacks", len(errs), len(stacks)))
+}
@@ -30,3 +30,32 @@ func getCmdStack() *cobra.Command {
 		Long:  stackLong,
 	}
 }
+
+// Add flag of the environment, e.g. for
+// commands only using the environment name.
+func addFlagEnv(cmd *cobra.Command) {
+	cmd.Flags().String(CMD_STACK_DEPLOY_ENV, "", "set enviornment folder you want to load values from. Multiple environments can be layered by using comma delimiter, e.g. 'prod,hotfix'")
+}
+
+// Add flags of the environment, vault passwords
+// and value overrides for commands loading values.
+func addFlagsEnvValues(cmd *cobra.Command) {
+	addFlagEnv(cmd)
+	cmd.Flags().StringP(CMD_VAULT_PASSWORD, "", "", "vault password for encryption or decryption")
+	cmd.Flags().StringP(CMD_VAULT_PASSWORD_FILE, "", "", "file that contains vault passwords for encryption or decryption")
+	cmd.Flags().StringArray(CMD_STACK_DEPLOY_VAR, nil, "override a value in the format of 'name=value'. It can be repeated. Only the first '=' is used as delimiter so the value can contain '=' or ','")
+	cmd.Flags().StringArray(CMD_STACK_DEPLOY_VAR_FILE, nil, "file containing values to override in YAML, JSON, TOML or dotenv format. It can be repeated and the later file overrides the earlier one")
+}
+
+// Get value overrides from stack command flags.
+func getValueOverrides(cmd *cobra.Command) *valueOverrides {
+	ov := new(valueOverrides)
+	ov.varFiles, _ = cmd.Flags().GetStringArray(CMD_STACK_DEPLOY_VAR_FILE)
+	ov.vars, _ = cmd.Flags().GetStringArray(CMD_STACK_DEPLOY_VAR)
+
+	if f := cmd.Flags().Lookup(CMD_STACK_DEPLOY_VARS); f != nil {
+		ov.varList = f.Value.String()
+	}
+
+	return ov
+}
@@ -7,6 +7,7 @@ import (
 
 	cf "github.com/aws/aws-sdk-go/service/cloudformation"
 	ctlaws "github.com/liangrog/cfctl/pkg/aws"
+	"github.com/liangrog/cfctl/pkg/template/cfn"
 	"github.com/liangrog/cfctl/pkg/utils"
 	"github.com/spf13/cobra"
 )
@@ -21,6 +22,7 @@ func init() {
 
 func addFlagsTemplateValidate(cmd *cobra.Command) {
 	cmd.Flags().BoolP(CMD_TEMPLATE_VALIDATE_RECURSIVE, "r", true, "recursively validate templates for given path")
+	cmd.Flags().BoolP(CMD_TEMPLATE_VALIDATE_OFFLINE, "", false, "validate templates locally by rules without calling AWS")
 }
 
 // cmd: validate
@@ -29,7 +31,17 @@ func getCmdTemplateValidate() *cobra.Command {
 		Use:   "validate",
 		Short: "Validate Cloudformation template. Example 'cfctl template validate [template path or s3 url]'",
 		Long: `Validate Cloudformation template by given path.
-This command can be run recursively by using '-r' option`,
+This command can be run recursively by using '-r' option.
+
+With '--offline', templates are checked locally without calling AWS for
+undefined Ref, GetAtt and condition targets, unused parameters and
+conditions, circular dependencies, duplicate logical IDs, invalid export
+names and template size limits. Findings are either errors or warnings,
+only errors fail the validation. Templates with a Transform, e.g. SAM,
+only get warnings for undefined targets as the transform adds resources.
+Templates over 51200 bytes get a warning as they can only be deployed from
+S3, e.g. as nested templates of "tpl"; stack dry-run reports an error for
+such stack templates since they are sent inline.`,
 		Args: func(cmd *cobra.Command, args []string) error {
 			if len(args) < 1 {
 				return errors.New(utils.MsgFormat("One template path or url is required", utils.MessageTypeError))
@@ -39,12 +51,22 @@ This command can be run recursively by using '-r' option`,
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			recursive, _ := cmd.Flags().GetBool(CMD_TEMPLATE_VALIDATE_RECURSIVE)
-
-			err := templateValidate(
-				cmd.Flags().Lookup(CMD_ROOT_OUTPUT).Value.String(),
-				args,
-				recursive,
-			)
+			offline, _ := cmd.Flags().GetBool(CMD_TEMPLATE_VALIDATE_OFFLINE)
+
+			var err error
+			if offline {
+				err = templateValidateOffline(
+					cmd.Flags().Lookup(CMD_ROOT_OUTPUT).Value.String(),
+					args,
+					recursive,
+				)
+			} else {
+				err = templateValidate(
+					cmd.Flags().Lookup(CMD_ROOT_OUTPUT).Value.String(),
+					args,
+					recursive,
+				)
+			}
 
 			silenceUsageOnError(cmd, err)
 
@@ -121,3 +143,55 @@ func tplValid(stack *ctlaws.Stack, path string) error {
 
 	return err
 }
+
+// Validate templates locally by rules
+func templateValidateOffline(format string, paths []string, recursive bool) error {
+	var files []string
+	for _, path := range paths {
+		if utils.IsUrlRegexp(path) {
+			return errors.New(fmt.Sprintf("%s can't be validated offline, only local templates are supported", path))
+		}
+
+		if ok, _ := utils.IsDir(path); ok {
+			found, err := utils.FindFiles(path, recursive)
+			if err != nil {
+				return err
+			}
+
+			files = append(files, found...)
+		} else {
+			files = append(files, path)
+		}
+	}
+
+	var findings []*cfn.Finding
+	var errCount int
+	for _, file := range files {
+		tplByte, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range cfn.Lint(file, tplByte) {
+			if f.IsError() {
+				errCount++
+			}
+
+			findings = append(findings, f)
+		}
+	}
+
+	if len(findings) == 0 {
+		return utils.Print(utils.FormatType(format), "No error found")
+	}
+
+	if err := utils.Print(utils.FormatType(format), findings); err != nil {
+		return err
+	}
+
+	if errCount > 0 {
+		return errors.New(fmt.Sprintf("Templates are invalid: %d errors, %d warnings", errCount, len(findings)-errCount))
+	}
+
+	return nil
+}
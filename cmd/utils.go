@@ -12,3 +12,13 @@ func silenceUsageOnError(cmd *cobra.Command, err error) {
 		cmd.SilenceUsage = true
 	}
 }
+
+// Get vault passwords from command flags.
+func getVaultPasswords(cmd *cobra.Command) ([]string, error) {
+	return GetPasswords(
+		cmd.Flags().Lookup(CMD_VAULT_PASSWORD).Value.String(),
+		cmd.Flags().Lookup(CMD_VAULT_PASSWORD_FILE).Value.String(),
+		false,
+		true,
+	)
+}
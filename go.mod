@@ -5,14 +5,16 @@ require (
 	github.com/aws/aws-sdk-go v1.34.0
 	github.com/golang/glog v0.0.0-20160126235308-23def4e6c14b
 	github.com/google/uuid v1.1.1
-	github.com/liangrog/ds v0.0.0-20191031210726-fd872fe1680c
 	github.com/liangrog/vault v1.0.0
+	github.com/pelletier/go-toml v1.2.0
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/russross/blackfriday v1.5.2
 	github.com/spf13/cobra v0.0.5
 	github.com/spf13/viper v1.3.2
 	github.com/stretchr/testify v1.5.1
 	golang.org/x/crypto v0.1.0
 	gopkg.in/yaml.v2 v2.2.8
+	gopkg.in/yaml.v3 v3.0.1
 	k8s.io/klog v1.0.0
 	k8s.io/kubectl v0.0.0-20191015071726-6d12ae1ac20b
 )
@@ -36,8 +38,6 @@ require (
 	github.com/mitchellh/mapstructure v1.1.2 // indirect
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.1 // indirect
-	github.com/pelletier/go-toml v1.2.0 // indirect
-	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/sirupsen/logrus v1.4.2 // indirect
 	github.com/spf13/afero v1.2.2 // indirect
 	github.com/spf13/cast v1.3.0 // indirect
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -111,18 +112,46 @@ func (s *Stack) TagSlice(tags map[string]string) []*cf.Tag {
 	return t
 }
 
-// Convert params from map to Parameter slice
-func (s *Stack) ParamSlice(params map[string]string) []*cf.Parameter {
+// Convert params from map to Parameter slice sorted by key.
+// Parameters of given keys use their previous values instead.
+func (s *Stack) ParamSlice(params map[string]string, usePrevious ...string) []*cf.Parameter {
+	var keys []string
+	for k := range params {
+		keys = append(keys, k)
+	}
+
+	for _, k := range usePrevious {
+		if _, ok := params[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
 	var p []*cf.Parameter
-	for k, v := range params {
-		p = append(p, new(cf.Parameter).SetParameterKey(k).SetParameterValue(v))
+	for _, k := range keys {
+		if utils.InSlice(usePrevious, k) {
+			p = append(p, new(cf.Parameter).SetParameterKey(k).SetUsePreviousValue(true))
+			continue
+		}
+
+		p = append(p, new(cf.Parameter).SetParameterKey(k).SetParameterValue(params[k]))
 	}
 
 	return p
 }
 
+// Optional settings of stack creation and update
+type StackOptions struct {
+	// Parameters keeping their previous values on update
+	UsePreviousValue []string
+
+	// Stack policy body in JSON
+	StackPolicy string
+}
+
 // Create a stack
-func (s *Stack) CreateStack(name string, params map[string]string, tags map[string]string, tpl []byte, url string) (*cf.CreateStackOutput, error) {
+func (s *Stack) CreateStack(name string, params map[string]string, tags map[string]string, tpl []byte, url string, opts *StackOptions) (*cf.CreateStackOutput, error) {
 	var stackOutput *cf.CreateStackOutput
 
 	// Validate template
@@ -139,6 +168,10 @@ func (s *Stack) CreateStack(name string, params map[string]string, tags map[stri
 		SetCapabilities(valid.Capabilities).
 		SetTags(s.TagSlice(tags))
 
+	if opts != nil && len(opts.StackPolicy) > 0 {
+		input.SetStackPolicyBody(opts.StackPolicy)
+	}
+
 	// Template
 	if len(tpl) > 0 {
 		input.SetTemplateBody(string(tpl))
@@ -150,7 +183,7 @@ func (s *Stack) CreateStack(name string, params map[string]string, tags map[stri
 }
 
 // Update stack
-func (s *Stack) UpdateStack(name string, params map[string]string, tags map[string]string, tpl []byte, url string) (*cf.UpdateStackOutput, error) {
+func (s *Stack) UpdateStack(name string, params map[string]string, tags map[string]string, tpl []byte, url string, opts *StackOptions) (*cf.UpdateStackOutput, error) {
 	var output *cf.UpdateStackOutput
 
 	// Validate template
@@ -161,12 +194,21 @@ func (s *Stack) UpdateStack(name string, params map[string]string, tags map[stri
 
 	tags = tagPkgStamp(tags)
 
+	var usePrevious []string
+	if opts != nil {
+		usePrevious = opts.UsePreviousValue
+	}
+
 	input := new(cf.UpdateStackInput).
 		SetStackName(name).
-		SetParameters(s.ParamSlice(params)).
+		SetParameters(s.ParamSlice(params, usePrevious...)).
 		SetCapabilities(Valid.Capabilities).
 		SetTags(s.TagSlice(tags))
 
+	if opts != nil && len(opts.StackPolicy) > 0 {
+		input.SetStackPolicyBody(opts.StackPolicy)
+	}
+
 	// Template
 	if len(tpl) > 0 {
 		input.SetTemplateBody(string(tpl))
@@ -177,6 +219,127 @@ func (s *Stack) UpdateStack(name string, params map[string]string, tags map[stri
 	return s.Client.UpdateStack(input)
 }
 
+// Create a change set of creating or updating a stack by
+// given change set type, "CREATE" or "UPDATE". The stack
+// policy isn't supported by change sets.
+func (s *Stack) CreateChangeSet(name, changeSetName, changeSetType string, params map[string]string, tags map[string]string, tpl []byte, url string, opts *StackOptions) (*cf.CreateChangeSetOutput, error) {
+	var output *cf.CreateChangeSetOutput
+
+	// Validate template
+	valid, err := s.ValidateTemplate(tpl, url)
+	if err != nil {
+		return output, err
+	}
+
+	tags = tagPkgStamp(tags)
+
+	var usePrevious []string
+	if opts != nil {
+		usePrevious = opts.UsePreviousValue
+	}
+
+	input := new(cf.CreateChangeSetInput).
+		SetStackName(name).
+		SetChangeSetName(changeSetName).
+		SetChangeSetType(changeSetType).
+		SetParameters(s.ParamSlice(params, usePrevious...)).
+		SetCapabilities(valid.Capabilities).
+		SetTags(s.TagSlice(tags))
+
+	// Template
+	if len(tpl) > 0 {
+		input.SetTemplateBody(string(tpl))
+	} else {
+		input.SetTemplateURL(url)
+	}
+
+	return s.Client.CreateChangeSet(input)
+}
+
+// Wait until a change set is created and return its description.
+// A change set failed to create is returned without error, its
+// status and reason tell why, e.g. there is no change.
+func (s *Stack) WaitChangeSet(changeSetId string) (*cf.DescribeChangeSetOutput, error) {
+	input := new(cf.DescribeChangeSetInput).SetChangeSetName(changeSetId)
+
+	// The waiter fails if the change set fails
+	waitErr := s.Client.WaitUntilChangeSetCreateComplete(input)
+
+	out, err := s.DescribeChangeSet(changeSetId)
+	if err != nil {
+		return nil, err
+	}
+
+	if waitErr != nil && aws.StringValue(out.Status) != cf.ChangeSetStatusFailed {
+		return nil, waitErr
+	}
+
+	return out, nil
+}
+
+// Describe a change set by its ARN with all its changes
+func (s *Stack) DescribeChangeSet(changeSetId string) (*cf.DescribeChangeSetOutput, error) {
+	var result *cf.DescribeChangeSetOutput
+	var nextToken *string
+
+	for {
+		input := new(cf.DescribeChangeSetInput).SetChangeSetName(changeSetId)
+		input.NextToken = nextToken
+
+		out, err := s.Client.DescribeChangeSet(input)
+		if err != nil {
+			return nil, err
+		}
+
+		if result == nil {
+			result = out
+		} else {
+			result.Changes = append(result.Changes, out.Changes...)
+		}
+
+		if out.NextToken == nil {
+			break
+		}
+
+		nextToken = out.NextToken
+	}
+
+	result.NextToken = nil
+
+	return result, nil
+}
+
+// If a change set failed because there is no change
+func IsNoChange(cs *cf.DescribeChangeSetOutput) bool {
+	reason := aws.StringValue(cs.StatusReason)
+
+	return aws.StringValue(cs.Status) == cf.ChangeSetStatusFailed &&
+		(strings.Contains(reason, "didn't contain changes") || strings.Contains(reason, "No updates are to be performed"))
+}
+
+// Execute a change set by its ARN
+func (s *Stack) ExecuteChangeSet(changeSetId string) error {
+	_, err := s.Client.ExecuteChangeSet(new(cf.ExecuteChangeSetInput).SetChangeSetName(changeSetId))
+
+	return err
+}
+
+// Delete a change set by its ARN
+func (s *Stack) DeleteChangeSet(changeSetId string) error {
+	_, err := s.Client.DeleteChangeSet(new(cf.DeleteChangeSetInput).SetChangeSetName(changeSetId))
+
+	return err
+}
+
+// Set the policy of a stack
+func (s *Stack) SetStackPolicy(stackName, policy string) error {
+	_, err := s.Client.SetStackPolicy(new(cf.SetStackPolicyInput).
+		SetStackName(stackName).
+		SetStackPolicyBody(policy))
+
+	return err
+}
+
 // Delete a stack
 func (s *Stack) DeleteStack(stackName string, retainResc ...string) (*cf.DeleteStackOutput, error) {
 	input := new(cf.DeleteStackInput).
@@ -242,6 +405,21 @@ func (s *Stack) DescribeStacks() ([]*cf.Stack, error) {
 	return out, nil
 }
 
+// Return the original template body of a stack as it was
+// submitted, before any transform is processed.
+func (s *Stack) GetTemplate(stackName string) (string, error) {
+	input := new(cf.GetTemplateInput).
+		SetStackName(stackName).
+		SetTemplateStage(cf.TemplateStageOriginal)
+
+	out, err := s.Client.GetTemplate(input)
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(out.TemplateBody), nil
+}
+
 // Kick off a stack drift detection process. Returns a
 // detection process Id to be used for status query
 func (s *Stack) DetectStackDrift(stackName string, resourceIds ...string) (string, error) {
@@ -71,6 +71,58 @@ func (fc *stackFakeClient) DescribeStacks(input *cf.DescribeStacksInput) (*cf.De
 	}, nil
 }
 
+func (fc *stackFakeClient) GetTemplate(input *cf.GetTemplateInput) (*cf.GetTemplateOutput, error) {
+	return new(cf.GetTemplateOutput).SetTemplateBody("Resources: {}"), nil
+}
+
+func (fc *stackFakeClient) CreateChangeSet(input *cf.CreateChangeSetInput) (*cf.CreateChangeSetOutput, error) {
+	return new(cf.CreateChangeSetOutput).SetId("arn:changeset/" + *input.ChangeSetName), nil
+}
+
+func (fc *stackFakeClient) WaitUntilChangeSetCreateComplete(input *cf.DescribeChangeSetInput) error {
+	if *input.ChangeSetName == "arn:changeset/same" {
+		return errors.New("ResourceNotReady: failed waiting for successful resource state")
+	}
+
+	return nil
+}
+
+func (fc *stackFakeClient) DescribeChangeSet(input *cf.DescribeChangeSetInput) (*cf.DescribeChangeSetOutput, error) {
+	out := new(cf.DescribeChangeSetOutput).
+		SetChangeSetId(*input.ChangeSetName).
+		SetStatus(cf.ChangeSetStatusCreateComplete)
+
+	if *input.ChangeSetName == "arn:changeset/same" {
+		return out.
+			SetStatus(cf.ChangeSetStatusFailed).
+			SetStatusReason("The submitted information didn't contain changes. Submit different information to create a change set."), nil
+	}
+
+	// Two pages of changes
+	change := new(cf.Change).SetResourceChange(new(cf.ResourceChange).SetLogicalResourceId("Bucket"))
+	if input.NextToken == nil {
+		out.SetNextToken("next")
+	}
+
+	return out.SetChanges([]*cf.Change{change}), nil
+}
+
+func (fc *stackFakeClient) ExecuteChangeSet(input *cf.ExecuteChangeSetInput) (*cf.ExecuteChangeSetOutput, error) {
+	return new(cf.ExecuteChangeSetOutput), nil
+}
+
+func (fc *stackFakeClient) DeleteChangeSet(input *cf.DeleteChangeSetInput) (*cf.DeleteChangeSetOutput, error) {
+	return new(cf.DeleteChangeSetOutput), nil
+}
+
+func (fc *stackFakeClient) SetStackPolicy(input *cf.SetStackPolicyInput) (*cf.SetStackPolicyOutput, error) {
+	if len(aws.StringValue(input.StackPolicyBody)) == 0 {
+		return nil, errors.New("StackPolicyBody or StackPolicyURL is required")
+	}
+
+	return new(cf.SetStackPolicyOutput), nil
+}
+
 func (fc *stackFakeClient) WaitUntilStackCreateComplete(input *cf.DescribeStacksInput) error {
 	return nil
 }
@@ -156,6 +208,26 @@ func TestParamSlice(t *testing.T) {
 	assert.Equal(t, "testing", *params[0].ParameterValue)
 }
 
+func TestParamSliceUsePrevious(t *testing.T) {
+	data := map[string]string{
+		"S3Name":     "testing",
+		"DbPassword": "secret",
+	}
+
+	params := NewStack(&stackFakeClient{}).ParamSlice(data, "DbPassword", "ApiKey")
+	assert.Equal(t, 3, len(params))
+
+	// Sorted by key
+	assert.Equal(t, "ApiKey", *params[0].ParameterKey)
+	assert.True(t, *params[0].UsePreviousValue)
+	assert.Equal(t, "DbPassword", *params[1].ParameterKey)
+	assert.True(t, *params[1].UsePreviousValue)
+	assert.Nil(t, params[1].ParameterValue)
+	assert.Equal(t, "S3Name", *params[2].ParameterKey)
+	assert.Equal(t, "testing", *params[2].ParameterValue)
+	assert.Nil(t, params[2].UsePreviousValue)
+}
+
 func TestListStacks(t *testing.T) {
 	testData := []map[string]string{
 		nil,
@@ -191,10 +263,34 @@ func TestValidateTemplate(t *testing.T) {
 }
 
 func TestCreateStack(t *testing.T) {
-	_, err := stack.CreateStack("testing", nil, nil, nil, "https://s3")
+	_, err := stack.CreateStack("testing", nil, nil, nil, "https://s3", nil)
 	assert.NoError(t, err)
 }
 
+func TestChangeSet(t *testing.T) {
+	out, err := stack.CreateChangeSet("testing", "cs", cf.ChangeSetTypeCreate, nil, nil, nil, "https://s3", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "arn:changeset/cs", aws.StringValue(out.Id))
+
+	cs, err := stack.WaitChangeSet("arn:changeset/cs")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(cs.Changes))
+	assert.Nil(t, cs.NextToken)
+	assert.False(t, IsNoChange(cs))
+
+	cs, err = stack.WaitChangeSet("arn:changeset/same")
+	assert.NoError(t, err)
+	assert.True(t, IsNoChange(cs))
+
+	assert.NoError(t, stack.ExecuteChangeSet("arn:changeset/cs"))
+	assert.NoError(t, stack.DeleteChangeSet("arn:changeset/cs"))
+}
+
+func TestSetStackPolicy(t *testing.T) {
+	assert.NoError(t, stack.SetStackPolicy("testing", `{"Statement": []}`))
+	assert.Error(t, stack.SetStackPolicy("testing", ""))
+}
+
 func TestDeleteStack(t *testing.T) {
 	_, err := stack.DeleteStack("testing")
 	assert.NoError(t, err)
@@ -215,6 +311,12 @@ func TestDescribeStacks(t *testing.T) {
 	assert.True(t, len(s) > 0)
 }
 
+func TestGetTemplate(t *testing.T) {
+	body, err := stack.GetTemplate("test")
+	assert.NoError(t, err)
+	assert.Equal(t, "Resources: {}", body)
+}
+
 func TestDetectStackDrift(t *testing.T) {
 	id, err := stack.DetectStackDrift("test")
 	assert.NoError(t, err)
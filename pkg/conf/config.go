@@ -3,6 +3,7 @@ package conf
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"path"
 	"path/filepath"
@@ -18,6 +19,20 @@ import (
 const (
 	// Default deployment package config file name
 	DEFAULT_DEPLOY_CONFIG_FILE_NAME = "stacks.yaml"
+
+	// File suffix for templates that need rendering before use
+	TEMPLATED_FILE_SUFFIX = ".tmpl"
+
+	// Built-in key holding the environment name in config file
+	CONFIG_DATA_ENV = "Env"
+
+	// Built-in key holding all the layered environment names
+	CONFIG_DATA_ENVS = "Envs"
+
+	// Delimiters of stack settings rendered after the stack
+	// file, e.g. per forEach item or with stack outputs.
+	DEFERRED_LEFT_DELIM  = "[["
+	DEFERRED_RIGHT_DELIM = "]]"
 )
 
 // Deploy configuration
@@ -34,6 +49,19 @@ type DeployConfig struct {
 	// Template directory
 	ParamDir string `yaml:"paramDir"`
 
+	// Values schema file. Default to "values.schema.yaml"
+	// in the same directory as the environments directory.
+	ValuesSchema string `yaml:"valuesSchema,omitempty"`
+
+	// Other stack files to include, relative to this file
+	Include []string `yaml:"include,omitempty"`
+
+	// Default settings for every stack
+	Defaults *StackConfig `yaml:"defaults,omitempty"`
+
+	// Tags for every stack
+	Tags map[string]string `yaml:"tags,omitempty"`
+
 	// Stacks config
 	Stacks []*StackConfig `yaml:"stacks"`
 
@@ -49,20 +77,230 @@ type StackConfig struct {
 	// Template relative path
 	Tpl string `yaml:"tpl"`
 
-	// Parameter file relative path
-	Param string `yaml:"param,omitempty"`
+	// Parameter file relative path, or a list of
+	// them merged in order, the later one winning.
+	Param ParamFiles `yaml:"param,omitempty"`
+
+	// Inline parameters merged after the parameter files. Values
+	// are rendered as parameter files with "[[ ]]" delimiters.
+	Parameters map[string]string `yaml:"parameters,omitempty"`
+
+	// Parameters keeping their previous values on stack update
+	UsePreviousValue []string `yaml:"usePreviousValue,omitempty"`
 
 	Tags map[string]string `yaml:"tags,omitempty"`
+
+	// Render the template with env values before use
+	Render bool `yaml:"render,omitempty"`
+
+	// Names of the stacks this stack depends on
+	DependsOn []string `yaml:"dependsOn,omitempty"`
+
+	// Deployment wave. Stacks in a lower wave are
+	// deployed before the ones in a higher wave.
+	Wave int `yaml:"wave,omitempty"`
+
+	// Alias of wave
+	Stage int `yaml:"stage,omitempty"`
+
+	// Parameter directory for this stack, overriding
+	// the paramDir. Relative to the main stack file.
+	ParamDir string `yaml:"paramDir,omitempty"`
+
+	// Repeat the stack for each item of an inline list or a
+	// list value of the environment. Expanded stacks keep it.
+	ForEach *ForEach `yaml:"forEach,omitempty"`
+
+	// Deploy the stack only if it's "true". It can be a template
+	// using "[[ ]]" delimiters evaluated against the values.
+	Enabled string `yaml:"enabled,omitempty"`
+
+	// Deploy the stack only to these environments. It
+	// matches any environment in the resolved chain.
+	Envs []string `yaml:"envs,omitempty"`
+
+	// The stack file defining the stack
+	source string
+
+	// Why the stack is disabled for the environment
+	disabled string
+
+	// The item of a stack expanded from forEach
+	item interface{}
+
+	// Keys set in the stack file, even to zero values
+	keys map[string]bool
+}
+
+// Unmarshal a stack config and record the keys set
+func (sc *StackConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain StackConfig
+	if err := unmarshal((*plain)(sc)); err != nil {
+		return err
+	}
+
+	var keys map[string]interface{}
+	if err := unmarshal(&keys); err != nil {
+		return err
+	}
+
+	sc.keys = make(map[string]bool, len(keys))
+	for k := range keys {
+		sc.keys[k] = true
+	}
+
+	return nil
+}
+
+// If the stack has parameter files or inline parameters
+func (sc *StackConfig) HasParams() bool {
+	return len(sc.Param) > 0 || len(sc.Parameters) > 0
+}
+
+// Parameter files of a stack
+type ParamFiles []string
+
+// Unmarshal parameter files from a file or a list of files
+func (pf *ParamFiles) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		if len(s) > 0 {
+			*pf = ParamFiles{s}
+		}
+
+		return nil
+	}
+
+	var l []string
+	if err := unmarshal(&l); err != nil {
+		return errors.New("param must be a file or a list of files")
+	}
+
+	*pf = l
+
+	return nil
+}
+
+// Return the stack file defining the stack
+func (sc *StackConfig) Source() string {
+	return sc.source
+}
+
+// If the stack is enabled for the environment
+func (sc *StackConfig) IsEnabled() bool {
+	return len(sc.disabled) == 0
+}
+
+// Return why the stack is disabled for the environment
+func (sc *StackConfig) DisabledReason() string {
+	return sc.disabled
+}
+
+// Return the item of a stack expanded from forEach
+func (sc *StackConfig) Item() interface{} {
+	return sc.item
+}
+
+// Return the values for rendering the stack's parameter file
+// and template. Expanded stacks have their item as ".item".
+func (sc *StackConfig) Values(kv map[string]interface{}) map[string]interface{} {
+	if sc.item == nil {
+		return kv
+	}
+
+	values := make(map[string]interface{}, len(kv)+1)
+	for k, v := range kv {
+		values[k] = v
+	}
+
+	values[STACK_DATA_ITEM] = sc.item
+
+	return values
+}
+
+// Return the deployment wave of the stack
+func (sc *StackConfig) GetWave() int {
+	if sc.Wave != 0 {
+		return sc.Wave
+	}
+
+	return sc.Stage
+}
+
+// If the stack template needs rendering. It's either
+// opted in or the template file has ".tmpl" suffix.
+func (sc *StackConfig) IsTemplated() bool {
+	return sc.Render || IsTemplatedFile(sc.Tpl)
+}
+
+// If given template file needs rendering by its suffix
+func IsTemplatedFile(n string) bool {
+	return strings.HasSuffix(n, TEMPLATED_FILE_SUFFIX)
 }
 
 // Load deploy config from file.
 // If no file path given, default to lookup
 // file "stacks.yaml" at current directory.
 func NewDeployConfig(file string) (*DeployConfig, error) {
+	return NewDeployConfigWithValues(file, "", nil)
+}
+
+// Load deploy config from file with the environment name and
+// its values. The config file is rendered with the values
+// plus the built-in ".Env" holding the environment name.
+// If multiple environments given, ".Env" is the first one, the
+// base environment, and ".Envs" has all of them in order.
+func NewDeployConfigWithValues(file, env string, values map[string]interface{}) (*DeployConfig, error) {
+	dc, err := loadDeployConfig(file, env, values)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dc.Validate(); err != nil {
+		return nil, err
+	}
+
+	return dc, nil
+}
+
+// Load deploy config from file with only the environment name,
+// e.g. to locate the environment folder before loading its
+// values, or to find stacks by name. Values used by the config
+// are rendered as "<no value>" so the paths aren't validated.
+func NewDeployConfigWithoutValues(file, env string) (*DeployConfig, error) {
+	return loadDeployConfig(file, env, nil)
+}
+
+// Load deploy config from file without validating it
+func loadDeployConfig(file, env string, values map[string]interface{}) (*DeployConfig, error) {
 	if len(file) == 0 {
 		file = DEFAULT_DEPLOY_CONFIG_FILE_NAME
 	}
 
+	dc, err := loadConfigFile(file, env, values)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load stacks from included files and apply defaults
+	if dc.Stacks, err = loadStacks(dc, file, env, values); err != nil {
+		return nil, err
+	}
+
+	dc.absPath, err = filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dc.disableStacks(env, values); err != nil {
+		return nil, err
+	}
+
+	return dc, nil
+}
+
+// Render and parse a config file with given values
+func loadConfigFile(file, env string, values map[string]interface{}) (*DeployConfig, error) {
 	data, err := ioutil.ReadFile(file)
 	if err != nil {
 		return nil, err
@@ -74,31 +312,45 @@ func NewDeployConfig(file string) (*DeployConfig, error) {
 		funcs.FUNC_NAME_HASH:           funcs.Md5,
 	}
 
-	tmpl, err := template.New(uuid.New().String()).Funcs(funcMap).Parse(string(data))
+	// Missing values are rendered as "<no value>", nested ones
+	// included, as values aren't known when loading without them.
+	tmpl, err := template.New(uuid.New().String()).Option("missingkey=default").Funcs(funcMap).Parse(string(data))
 	if err != nil {
 		return nil, err
 	}
 
 	var b bytes.Buffer
-	if err := tmpl.Execute(&b, nil); err != nil {
+	if err := tmpl.Execute(&b, configData(env, values)); err != nil {
 		return nil, err
 	}
 
 	dc := new(DeployConfig)
 	if err := yaml.Unmarshal(b.Bytes(), dc); err != nil {
-		return nil, err
+		return nil, errors.New(fmt.Sprintf("Failed to parse %s: %s", file, err))
 	}
 
-	dc.absPath, err = filepath.Abs(filepath.Dir(file))
-	if err != nil {
-		return nil, err
+	return dc, nil
+}
+
+// Data for rendering the config file
+func configData(env string, values map[string]interface{}) map[string]interface{} {
+	data := make(map[string]interface{})
+	for k, v := range values {
+		data[k] = v
 	}
 
-	if err := dc.Validate(); err != nil {
-		return nil, err
+	// Use the base one if multiple environments given,
+	// the others are only overlays, e.g. "prod,hotfix".
+	var name string
+	envs := SplitEnvs(env)
+	if len(envs) > 0 {
+		name = envs[0]
 	}
 
-	return dc, nil
+	data[CONFIG_DATA_ENV] = name
+	data[CONFIG_DATA_ENVS] = envs
+
+	return data
 }
 
 // Validate path configuration
@@ -117,6 +369,18 @@ func (dc *DeployConfig) Validate() error {
 		msg = "There is a problem with paramDir in configuration."
 	}
 
+	for _, sc := range dc.Stacks {
+		if sc.Wave != 0 && sc.Stage != 0 && sc.Wave != sc.Stage {
+			msg = fmt.Sprintf("Stack %s has different wave and stage in configuration.", sc.Name)
+		}
+
+		if len(sc.ParamDir) > 0 {
+			if ok, err := utils.IsDir(path.Join(dc.absPath, sc.ParamDir)); !ok || err != nil {
+				msg = fmt.Sprintf("There is a problem with paramDir of stack %s in configuration.", sc.Name)
+			}
+		}
+	}
+
 	if len(msg) > 0 {
 		return errors.New(utils.MsgFormat(msg, utils.MessageTypeError))
 	}
@@ -132,10 +396,45 @@ func (dc *DeployConfig) GetParamPath(n string) string {
 	return path.Join(dc.absPath, dc.ParamDir, n)
 }
 
+// Return the parameter file paths of given stack
+func (dc *DeployConfig) GetStackParamPaths(sc *StackConfig) []string {
+	var paths []string
+	for _, p := range sc.Param {
+		if len(sc.ParamDir) > 0 {
+			paths = append(paths, path.Join(dc.absPath, sc.ParamDir, p))
+		} else {
+			paths = append(paths, dc.GetParamPath(p))
+		}
+	}
+
+	return paths
+}
+
 func (dc *DeployConfig) GetEnvDirPath(n string) string {
 	return path.Join(dc.absPath, dc.EnvDir, n)
 }
 
+func (dc *DeployConfig) GetValuesSchemaPath() string {
+	if len(dc.ValuesSchema) > 0 {
+		return path.Join(dc.absPath, dc.ValuesSchema)
+	}
+
+	return path.Join(path.Dir(path.Join(dc.absPath, dc.EnvDir)), DEFAULT_VALUES_SCHEMA_FILE_NAME)
+}
+
+// Return the stack files defining the stacks, including
+// the ones included by the main stack file.
+func (dc *DeployConfig) GetStackFiles() []string {
+	var files []string
+	for _, sc := range dc.Stacks {
+		if len(sc.source) > 0 && !utils.InSlice(files, sc.source) {
+			files = append(files, sc.source)
+		}
+	}
+
+	return files
+}
+
 // Return a stack config by its name
 func (dc *DeployConfig) GetStackConfigByName(n string) *StackConfig {
 	for _, sc := range dc.Stacks {
@@ -219,24 +518,51 @@ func getFilters(f map[string]string) []filterConfig {
 	return sf
 }
 
-// Find stack config for given list
+// Find enabled stack config for given filters
 func (dc *DeployConfig) GetStackList(f map[string]string) map[string]*StackConfig {
 	result := make(map[string]*StackConfig)
+	for _, sc := range dc.GetStacks(f) {
+		result[sc.Name] = sc
+	}
+
+	return result
+}
+
+// Find enabled stack config for given filters. The
+// result follows the order in the config file.
+func (dc *DeployConfig) GetStacks(f map[string]string) []*StackConfig {
+	return dc.filterStacks(f, true)
+}
+
+// Find disabled stack config for given filters. The
+// result follows the order in the config file.
+func (dc *DeployConfig) GetDisabledStacks(f map[string]string) []*StackConfig {
+	return dc.filterStacks(f, false)
+}
+
+// Find stack config for given filters and enabled state
+func (dc *DeployConfig) filterStacks(f map[string]string, enabled bool) []*StackConfig {
+	var result []*StackConfig
 
 	filters := getFilters(f)
-	// Get the full list in the right format
 	for _, sc := range dc.Stacks {
-		result[sc.Name] = sc
-	}
+		if sc.IsEnabled() != enabled {
+			continue
+		}
 
-	for k, sc := range result {
+		matched := true
 		for _, f := range filters {
 			// If found not meet the given filter,
 			// remove from the result
 			if !f.funct(sc, f.value) {
-				delete(result, k)
+				matched = false
+				break
 			}
 		}
+
+		if matched {
+			result = append(result, sc)
+		}
 	}
 
 	return result
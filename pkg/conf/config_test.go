@@ -118,3 +118,163 @@ func TestGetStackList(t *testing.T) {
 
 	cleanup(tmpDir)
 }
+
+func TestGetStacks(t *testing.T) {
+	tmpDir, stackFile := setup(t)
+	defer cleanup(tmpDir)
+
+	dc, err := NewDeployConfig(stackFile)
+	assert.NoError(t, err)
+
+	// Always in the order of config file
+	for i := 0; i < 10; i++ {
+		sl := dc.GetStacks(map[string]string{"tag": "App=test"})
+		assert.Equal(t, 2, len(sl))
+		assert.Equal(t, "stack-a", sl[0].Name)
+		assert.Equal(t, "stack-b", sl[1].Name)
+	}
+
+	sl := dc.GetStacks(map[string]string{"name": "stack-b"})
+	assert.Equal(t, 1, len(sl))
+	assert.Equal(t, "stack-b", sl[0].Name)
+}
+
+func TestGetWave(t *testing.T) {
+	assert.Equal(t, 0, (&StackConfig{}).GetWave())
+	assert.Equal(t, 2, (&StackConfig{Wave: 2}).GetWave())
+	assert.Equal(t, 3, (&StackConfig{Stage: 3}).GetWave())
+
+	tmpDir, stackFile := setup(t)
+	defer cleanup(tmpDir)
+
+	dc, err := NewDeployConfig(stackFile)
+	assert.NoError(t, err)
+
+	dc.Stacks[0].Wave = 1
+	dc.Stacks[0].Stage = 1
+	assert.NoError(t, dc.Validate())
+
+	dc.Stacks[0].Stage = 2
+	assert.Error(t, dc.Validate())
+}
+
+func TestIsTemplated(t *testing.T) {
+	assert.False(t, (&StackConfig{Tpl: "vpc.yaml"}).IsTemplated())
+	assert.True(t, (&StackConfig{Tpl: "vpc.yaml", Render: true}).IsTemplated())
+	assert.True(t, (&StackConfig{Tpl: "vpc.yaml.tmpl"}).IsTemplated())
+	assert.True(t, IsTemplatedFile("nested/subnet.json.tmpl"))
+	assert.False(t, IsTemplatedFile("nested/subnet.json"))
+}
+
+func TestNewDeployConfigWithValues(t *testing.T) {
+	tmpDir, _ := setup(t)
+
+	stackFile, err := ioutil.TempFile(tmpDir, "stack.yaml.")
+	assert.NoError(t, err)
+	_, err = stackFile.Write([]byte(`
+s3Bucket: {{ .project }}-{{ .Env }}
+templateDir: templates
+envDir: env
+paramDir: param
+stacks:
+  - name: {{ .Env }}-vpc
+    tpl: vpc.yaml`))
+	assert.NoError(t, err)
+
+	dc, err := NewDeployConfigWithValues(stackFile.Name(), "prod", map[string]interface{}{"project": "demo"})
+	assert.NoError(t, err)
+	assert.Equal(t, "demo-prod", dc.S3Bucket)
+	assert.NotNil(t, dc.GetStackConfigByName("prod-vpc"))
+
+	// Overlays don't rename the stacks
+	dc, err = NewDeployConfigWithValues(stackFile.Name(), "prod, hotfix", map[string]interface{}{"project": "demo"})
+	assert.NoError(t, err)
+	assert.Equal(t, "demo-prod", dc.S3Bucket)
+	assert.NotNil(t, dc.GetStackConfigByName("prod-vpc"))
+
+	assert.Equal(t, []string{"prod", "hotfix"}, configData("prod,hotfix", nil)[CONFIG_DATA_ENVS])
+
+	cleanup(tmpDir)
+}
+
+func TestNewDeployConfigWithoutValues(t *testing.T) {
+	tmpDir, _ := setup(t)
+	defer cleanup(tmpDir)
+
+	stackFile, err := ioutil.TempFile(tmpDir, "stack.yaml.")
+	assert.NoError(t, err)
+	_, err = stackFile.Write([]byte(`
+s3Bucket: {{ .project.name }}-{{ .Env }}
+templateDir: templates
+envDir: env
+paramDir: {{ .paramDir }}
+stacks:
+  - name: {{ .Env }}-vpc
+    tpl: vpc.yaml`))
+	assert.NoError(t, err)
+
+	// Paths using values aren't validated without the values
+	dc, err := NewDeployConfigWithoutValues(stackFile.Name(), "prod")
+	assert.NoError(t, err)
+	assert.Equal(t, "env", dc.EnvDir)
+	assert.NotNil(t, dc.GetStackConfigByName("prod-vpc"))
+
+	_, err = NewDeployConfigWithValues(stackFile.Name(), "prod", map[string]interface{}{"project": map[string]interface{}{"name": "demo"}, "paramDir": "missing"})
+	assert.Error(t, err)
+
+	dc, err = NewDeployConfigWithValues(stackFile.Name(), "prod", map[string]interface{}{"project": map[string]interface{}{"name": "demo"}, "paramDir": "param"})
+	assert.NoError(t, err)
+	assert.Equal(t, "demo-prod", dc.S3Bucket)
+}
+
+func TestStackParams(t *testing.T) {
+	tmpDir, _ := setup(t)
+	defer cleanup(tmpDir)
+
+	stackFile, err := ioutil.TempFile(tmpDir, "stack.yaml.")
+	assert.NoError(t, err)
+	_, err = stackFile.Write([]byte(`
+templateDir: templates
+envDir: env
+paramDir: param
+defaults:
+  parameters:
+    Env: "{{ .Env }}"
+stacks:
+  - name: vpc
+    tpl: vpc.yaml
+    param: vpc.yaml
+  - name: rds
+    tpl: rds.yaml
+    param:
+      - common.yaml
+      - rds.yaml
+    parameters:
+      VpcId: '[[ stackOutput "vpc" "VpcId" ]]'
+    usePreviousValue:
+      - DbPassword
+  - name: dns
+    tpl: dns.yaml`))
+	assert.NoError(t, err)
+
+	dc, err := NewDeployConfigWithValues(stackFile.Name(), "prod", map[string]interface{}{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	vpc := dc.GetStackConfigByName("vpc")
+	assert.Equal(t, ParamFiles{"vpc.yaml"}, vpc.Param)
+	assert.Equal(t, map[string]string{"Env": "prod"}, vpc.Parameters)
+
+	rds := dc.GetStackConfigByName("rds")
+	assert.Equal(t, ParamFiles{"common.yaml", "rds.yaml"}, rds.Param)
+	assert.Equal(t, []string{dc.GetParamPath("common.yaml"), dc.GetParamPath("rds.yaml")}, dc.GetStackParamPaths(rds))
+	assert.Equal(t, map[string]string{"Env": "prod", "VpcId": `[[ stackOutput "vpc" "VpcId" ]]`}, rds.Parameters)
+	assert.Equal(t, []string{"DbPassword"}, rds.UsePreviousValue)
+	assert.True(t, rds.HasParams())
+
+	dns := dc.GetStackConfigByName("dns")
+	assert.Nil(t, dns.Param)
+	assert.True(t, dns.HasParams())
+	assert.False(t, (&StackConfig{}).HasParams())
+}
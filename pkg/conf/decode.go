@@ -0,0 +1,176 @@
+package conf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Decoder for value file content
+type valueDecoder func(dat []byte) (map[string]interface{}, error)
+
+// Value decoders keyed by file extension. Files
+// without extension are treated as yaml.
+var valueDecoders = map[string]valueDecoder{
+	"":      decodeYamlValues,
+	".yaml": decodeYamlValues,
+	".yml":  decodeYamlValues,
+	".json": decodeJsonValues,
+	".toml": decodeTomlValues,
+	".env":  decodeDotenvValues,
+}
+
+// Return the decoder for given value file. Nil is returned
+// if the file should be ignored, e.g. dotfiles and files
+// with unknown extension. A file named ".env" is a dotenv file.
+func getValueDecoder(path string) valueDecoder {
+	name := filepath.Base(path)
+	if name == ".env" {
+		return decodeDotenvValues
+	}
+
+	if strings.HasPrefix(name, ".") {
+		return nil
+	}
+
+	return valueDecoders[strings.ToLower(filepath.Ext(name))]
+}
+
+// Decode yaml values
+func decodeYamlValues(dat []byte) (map[string]interface{}, error) {
+	var tv map[string]valueNode
+	if err := yaml.Unmarshal(dat, &tv); err != nil {
+		return nil, err
+	}
+
+	return nodeMap(tv), nil
+}
+
+// Decode json values. Numbers are kept in their original text.
+func decodeJsonValues(dat []byte) (map[string]interface{}, error) {
+	if len(bytes.TrimSpace(dat)) == 0 {
+		return make(map[string]interface{}), nil
+	}
+
+	var m map[string]interface{}
+
+	d := json.NewDecoder(bytes.NewReader(dat))
+	d.UseNumber()
+	if err := d.Decode(&m); err != nil {
+		return nil, err
+	}
+
+	return normaliseValue(m).(map[string]interface{}), nil
+}
+
+// Decode toml values
+func decodeTomlValues(dat []byte) (map[string]interface{}, error) {
+	tree, err := toml.LoadBytes(dat)
+	if err != nil {
+		return nil, err
+	}
+
+	return normaliseValue(tree.ToMap()).(map[string]interface{}), nil
+}
+
+// Decode dotenv values in the form of "KEY=value" per line.
+// Lines can start with "export". Empty lines and lines
+// starting with "#" are skipped. Values can be single
+// quoted as literal or double quoted with escapes.
+func decodeDotenvValues(dat []byte) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+
+	scanner := bufio.NewScanner(bytes.NewReader(dat))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		kv := strings.SplitN(line, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || len(key) == 0 {
+			return nil, errors.New(fmt.Sprintf("line %d: expecting 'KEY=value'", n))
+		}
+
+		value, err := dotenvValue(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("line %d: %s", n, err))
+		}
+
+		values[key] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// Get the value of a dotenv line
+func dotenvValue(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		end := strings.LastIndex(s, `"`)
+		if end == 0 {
+			return "", errors.New("unterminated double quote")
+		}
+
+		return strconv.Unquote(s[:end+1])
+	case strings.HasPrefix(s, "'"):
+		end := strings.LastIndex(s, "'")
+		if end == 0 {
+			return "", errors.New("unterminated single quote")
+		}
+
+		return s[1:end], nil
+	}
+
+	// Strip inline comment
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+
+	return s, nil
+}
+
+// Normalise decoded value so scalars are strings the
+// same as the values from yaml files. Null is empty string.
+func normaliseValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case time.Time:
+		return val.Format(time.RFC3339)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, sv := range val {
+			m[k] = normaliseValue(sv)
+		}
+
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(val))
+		for i, sv := range val {
+			l[i] = normaliseValue(sv)
+		}
+
+		return l
+	}
+
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,142 @@
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/liangrog/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetValueDecoder(t *testing.T) {
+	for _, p := range []string{"a", "a.yaml", "a.YML", "a.json", "a.toml", "a.env", ".env", "dir/.env"} {
+		assert.NotNil(t, getValueDecoder(p), p)
+	}
+
+	for _, p := range []string{".DS_Store", ".gitkeep", ".a.yaml", "a.txt", "README.md"} {
+		assert.Nil(t, getValueDecoder(p), p)
+	}
+}
+
+func TestDecodeDotenvValues(t *testing.T) {
+	values, err := decodeDotenvValues([]byte(`
+# comment
+DB_HOST=localhost
+export DB_PORT = 3306
+URL=https://example.com/?a=b
+EMPTY=
+PLAIN=abc # comment
+SINGLE='a #b\n'
+DOUBLE="line1\nline2 \"quoted\""
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"DB_HOST": "localhost",
+		"DB_PORT": "3306",
+		"URL":     "https://example.com/?a=b",
+		"EMPTY":   "",
+		"PLAIN":   "abc",
+		"SINGLE":  `a #b\n`,
+		"DOUBLE":  "line1\nline2 \"quoted\"",
+	}, values)
+
+	_, err = decodeDotenvValues([]byte("A=1\nINVALID"))
+	assert.EqualError(t, err, "line 2: expecting 'KEY=value'")
+
+	_, err = decodeDotenvValues([]byte(`A="abc`))
+	assert.Error(t, err)
+}
+
+func TestDecodeJsonValues(t *testing.T) {
+	values, err := decodeJsonValues([]byte(`{
+  "port": 8080,
+  "ratio": 1.50,
+  "enabled": true,
+  "empty": null,
+  "subnets": ["subnet-a", 1],
+  "db": {"host": "localhost"}
+}`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"port":    "8080",
+		"ratio":   "1.50",
+		"enabled": "true",
+		"empty":   "",
+		"subnets": []interface{}{"subnet-a", "1"},
+		"db":      map[string]interface{}{"host": "localhost"},
+	}, values)
+
+	values, err = decodeJsonValues([]byte(" "))
+	assert.NoError(t, err)
+	assert.Empty(t, values)
+
+	_, err = decodeJsonValues([]byte(`["a"]`))
+	assert.Error(t, err)
+}
+
+func TestDecodeTomlValues(t *testing.T) {
+	values, err := decodeTomlValues([]byte(`
+port = 8080
+enabled = true
+subnets = ["subnet-a", "subnet-b"]
+
+[db]
+host = "localhost"
+
+[[users]]
+name = "a"
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"port":    "8080",
+		"enabled": "true",
+		"subnets": []interface{}{"subnet-a", "subnet-b"},
+		"db":      map[string]interface{}{"host": "localhost"},
+		"users":   []interface{}{map[string]interface{}{"name": "a"}},
+	}, values)
+
+	_, err = decodeTomlValues([]byte("port = "))
+	assert.Error(t, err)
+}
+
+func TestLoadValuesByExtension(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	pass := "password"
+	encrypted, err := vault.Encrypt([]byte(`{"secret": "s3cr3t"}`), pass)
+	assert.NoError(t, err)
+
+	files := map[string][]byte{
+		"a.yaml":    []byte("a: yaml\nb: yaml"),
+		"b.json":    []byte(`{"b": "json", "c": "json"}`),
+		"c.toml":    []byte(`c = "toml"`),
+		"d.env":     []byte("d=env"),
+		"e.json":    encrypted,
+		"notes.txt": []byte("not: loaded"),
+		".hidden":   []byte("hidden: true"),
+	}
+
+	for name, content := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, name), content, 0644))
+	}
+
+	values, err := LoadValues(tmpDir, []string{pass})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"a":      "yaml",
+		"b":      "json",
+		"c":      "toml",
+		"d":      "env",
+		"secret": "s3cr3t",
+	}, values)
+
+	// Parsing error reports the file
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, "f.json"), []byte("{"), 0644))
+	_, err = LoadValues(tmpDir, []string{pass})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "f.json")
+}
@@ -0,0 +1,99 @@
+package conf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/google/uuid"
+	"github.com/liangrog/cfctl/pkg/template/funcs"
+)
+
+// Disable the stacks not enabled for given environment. A stack
+// is disabled if none of its "envs" is a selected environment or
+// one they extend, or its "enabled" evaluates to false.
+// "enabled" is only evaluated when values are given.
+func (dc *DeployConfig) disableStacks(env string, values map[string]interface{}) error {
+	var chain []string
+	for _, sc := range dc.Stacks {
+		if len(sc.Envs) == 0 || chain != nil {
+			continue
+		}
+
+		resolved, err := ResolveEnvChain(dc.GetEnvDirPath(""), SplitEnvs(env))
+		if err != nil {
+			return err
+		}
+
+		// Selected environments may not have folders
+		chain = append(SplitEnvs(env), resolved...)
+	}
+
+	for _, sc := range dc.Stacks {
+		if len(sc.Envs) > 0 && !envsMatch(sc.Envs, chain) {
+			sc.disabled = fmt.Sprintf("environment isn't one of %s", strings.Join(sc.Envs, ", "))
+			continue
+		}
+
+		if len(sc.Enabled) == 0 || values == nil {
+			continue
+		}
+
+		enabled, err := evalEnabled(sc.Enabled, env, values, sc.item)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Stack %s has invalid enabled: %s", sc.Name, err))
+		}
+
+		if !enabled {
+			sc.disabled = "enabled is false"
+		}
+	}
+
+	return nil
+}
+
+// If any of the environments is in the chain
+func envsMatch(envs, chain []string) bool {
+	for _, e := range envs {
+		for _, c := range chain {
+			if e == c {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Evaluate "enabled" of a stack. It's rendered with "[[ ]]"
+// delimiters against the values and must be true or false.
+func evalEnabled(s, env string, values map[string]interface{}, item interface{}) (bool, error) {
+	data := configData(env, values)
+	if item != nil {
+		data[STACK_DATA_ITEM] = item
+	}
+
+	tmpl, err := template.New(uuid.New().String()).
+		Delims(DEFERRED_LEFT_DELIM, DEFERRED_RIGHT_DELIM).
+		Funcs(funcs.ValueFuncMap()).
+		Parse(s)
+	if err != nil {
+		return false, err
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return false, err
+	}
+
+	result := strings.TrimSpace(b.String())
+	enabled, err := strconv.ParseBool(result)
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("'%s' must be true or false", result))
+	}
+
+	return enabled, nil
+}
@@ -0,0 +1,76 @@
+package conf
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnabled(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "enabled")
+	assert.NoError(t, err)
+	defer cleanup(tmpDir)
+
+	writeFiles(t, tmpDir, map[string]string{
+		"env/dev/values.yaml":     "bastion: \"true\"",
+		"env/hotfix/_env.yaml":    "extends: staging",
+		"env/staging/values.yaml": "bastion: \"false\"",
+		"stacks.yaml": `
+envDir: env
+stacks:
+  - name: vpc
+    tpl: vpc.yaml
+  - name: bastion
+    tpl: bastion.yaml
+    enabled: "[[ .bastion ]]"
+  - name: debug
+    tpl: debug.yaml
+    envs: [dev, staging]
+  - name: "az-[[ .item ]]"
+    tpl: subnet.yaml
+    forEach: [a, b]
+    enabled: '[[ ne .item "b" ]]'`,
+	})
+
+	names := func(sl []*StackConfig) []string {
+		var result []string
+		for _, sc := range sl {
+			result = append(result, sc.Name)
+		}
+
+		return result
+	}
+
+	file := filepath.Join(tmpDir, "stacks.yaml")
+
+	dc, err := NewDeployConfigWithValues(file, "dev", map[string]interface{}{"bastion": "true"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []string{"vpc", "bastion", "debug", "az-a"}, names(dc.GetStacks(nil)))
+	assert.Equal(t, []string{"az-b"}, names(dc.GetDisabledStacks(nil)))
+	assert.Equal(t, "enabled is false", dc.GetStackConfigByName("az-b").DisabledReason())
+
+	// Environment extending an allowed one
+	dc, err = NewDeployConfigWithValues(file, "hotfix", map[string]interface{}{"bastion": "false"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vpc", "debug", "az-a"}, names(dc.GetStacks(nil)))
+	assert.Equal(t, 3, len(dc.GetStackList(nil)))
+
+	dc, err = NewDeployConfigWithValues(file, "prod", map[string]interface{}{"bastion": "false"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bastion", "debug", "az-b"}, names(dc.GetDisabledStacks(nil)))
+	assert.Equal(t, "environment isn't one of dev, staging", dc.GetStackConfigByName("debug").DisabledReason())
+	assert.Equal(t, []string{"debug"}, names(dc.GetDisabledStacks(map[string]string{"name": "debug"})))
+
+	// Enabled isn't evaluated without values
+	dc, err = NewDeployConfigWithValues(file, "prod", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vpc", "bastion", "az-a", "az-b"}, names(dc.GetStacks(nil)))
+
+	_, err = NewDeployConfigWithValues(file, "dev", map[string]interface{}{"bastion": "yes please"})
+	assert.EqualError(t, err, "Stack bastion has invalid enabled: 'yes please' must be true or false")
+}
@@ -0,0 +1,152 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/liangrog/cfctl/pkg/utils"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// Environment folder that is always loaded first
+	DEFAULT_ENV_FOLDER = "default"
+
+	// Environment meta file in an environment folder
+	ENV_META_FILE_NAME = "_env.yaml"
+)
+
+// Environment meta data
+type envMeta struct {
+	// Parent environment name
+	Extends string `yaml:"extends,omitempty"`
+}
+
+// Split comma delimited environment names
+func SplitEnvs(env string) []string {
+	var envs []string
+	for _, e := range strings.Split(env, ",") {
+		if e = strings.TrimSpace(e); len(e) > 0 {
+			envs = append(envs, e)
+		}
+	}
+
+	return envs
+}
+
+// Read the parent environment of given environment folder
+func envParent(root, env string) (string, error) {
+	dat, err := ioutil.ReadFile(filepath.Join(root, env, ENV_META_FILE_NAME))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	meta := new(envMeta)
+	if err := yaml.Unmarshal(dat, meta); err != nil {
+		return "", errors.New(fmt.Sprintf("Failed to parse %s of environment %s: %s", ENV_META_FILE_NAME, env, err))
+	}
+
+	return strings.TrimSpace(meta.Extends), nil
+}
+
+// Return the environment with its ancestors, the root ancestor first.
+func envLineage(root, env string) ([]string, error) {
+	var lineage []string
+
+	for name, child := env, ""; len(name) > 0; {
+		// Detect cycle
+		if utils.InSlice(lineage, name) {
+			path := append(lineage, name)
+			return nil, errors.New(fmt.Sprintf("Environment %s has circular inheritance: %s", env, strings.Join(path, " -> ")))
+		}
+
+		if yes, _ := utils.IsDir(filepath.Join(root, name)); !yes {
+			// Selected environment without folder is ignored
+			if len(child) == 0 {
+				return nil, nil
+			}
+
+			return nil, errors.New(fmt.Sprintf("Environment %s extends %s which doesn't exist", child, name))
+		}
+
+		lineage = append(lineage, name)
+
+		parent, err := envParent(root, name)
+		if err != nil {
+			return nil, err
+		}
+
+		child, name = name, parent
+	}
+
+	// Reverse so the root ancestor goes first
+	for i, j := 0, len(lineage)-1; i < j; i, j = i+1, j-1 {
+		lineage[i], lineage[j] = lineage[j], lineage[i]
+	}
+
+	return lineage, nil
+}
+
+// Resolve the environment folders to load values from in order.
+// The "default" folder goes first, followed by the inheritance
+// chain of each given environment. A folder is only loaded once.
+func ResolveEnvChain(root string, envs []string) ([]string, error) {
+	var chain []string
+
+	if yes, _ := utils.IsDir(filepath.Join(root, DEFAULT_ENV_FOLDER)); yes {
+		chain = append(chain, DEFAULT_ENV_FOLDER)
+	}
+
+	for _, env := range envs {
+		lineage, err := envLineage(root, env)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range lineage {
+			if !utils.InSlice(chain, e) {
+				chain = append(chain, e)
+			}
+		}
+	}
+
+	return chain, nil
+}
+
+// Load values for given environments from environment directory.
+// Values of a later folder in the chain override the earlier ones.
+func LoadEnvValues(root string, envs []string, passwords []string) (map[string]interface{}, error) {
+	values, _, err := LoadEnvValuesWithSource(root, envs, passwords)
+	return values, err
+}
+
+// Load values for given environments as LoadEnvValues
+// does. It also returns where each value comes from.
+func LoadEnvValuesWithSource(root string, envs []string, passwords []string) (map[string]interface{}, Provenance, error) {
+	chain, err := ResolveEnvChain(root, envs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := make(map[string]interface{})
+	prov := make(Provenance)
+	for _, env := range chain {
+		v, p, err := LoadValuesWithSource(filepath.Join(root, env), passwords)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		values = MergeValues(values, v)
+		prov.Merge(p)
+	}
+
+	return values, prov, nil
+}
@@ -0,0 +1,120 @@
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/liangrog/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+// Create environment folders with given files
+func setupEnvs(t *testing.T, files map[string]string) string {
+	tmpDir, err := ioutil.TempDir("", "test"+strconv.FormatInt(time.Now().Unix(), 10))
+	assert.NoError(t, err)
+
+	for name, content := range files {
+		p := filepath.Join(tmpDir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), os.ModePerm))
+		assert.NoError(t, ioutil.WriteFile(p, []byte(content), 0644))
+	}
+
+	return tmpDir
+}
+
+func TestSplitEnvs(t *testing.T) {
+	assert.Equal(t, 0, len(SplitEnvs("")))
+	assert.Equal(t, []string{"prod"}, SplitEnvs("prod"))
+	assert.Equal(t, []string{"prod", "hotfix"}, SplitEnvs("prod, hotfix,"))
+}
+
+func TestResolveEnvChain(t *testing.T) {
+	root := setupEnvs(t, map[string]string{
+		"default/vars.yaml":    "region: ap-southeast-2",
+		"prod/vars.yaml":       "size: large",
+		"prod-eu/_env.yaml":    "extends: prod",
+		"prod-eu/vars.yaml":    "region: eu-west-1",
+		"hotfix/vars.yaml":     "size: xlarge",
+		"loop-a/_env.yaml":     "extends: loop-b",
+		"loop-b/_env.yaml":     "extends: loop-a",
+		"orphan/_env.yaml":     "extends: missing",
+		"explicit/_env.yaml":   "extends: default",
+		"explicit/values.yaml": "a: b",
+	})
+	defer os.RemoveAll(root)
+
+	chain, err := ResolveEnvChain(root, []string{"prod-eu"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"default", "prod", "prod-eu"}, chain)
+
+	chain, err = ResolveEnvChain(root, []string{"prod-eu", "hotfix"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"default", "prod", "prod-eu", "hotfix"}, chain)
+
+	chain, err = ResolveEnvChain(root, []string{"explicit"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"default", "explicit"}, chain)
+
+	// Selected environment without folder is ignored
+	chain, err = ResolveEnvChain(root, []string{"staging"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"default"}, chain)
+
+	_, err = ResolveEnvChain(root, []string{"loop-a"})
+	assert.EqualError(t, err, "Environment loop-a has circular inheritance: loop-a -> loop-b -> loop-a")
+
+	_, err = ResolveEnvChain(root, []string{"orphan"})
+	assert.EqualError(t, err, "Environment orphan extends missing which doesn't exist")
+}
+
+func TestLoadEnvValues(t *testing.T) {
+	root := setupEnvs(t, map[string]string{
+		"default/vars.yaml": "region: ap-southeast-2\nsize: small",
+		"prod/vars.yaml":    "size: large",
+		"prod-eu/_env.yaml": "extends: prod",
+		"prod-eu/vars.yaml": "region: eu-west-1",
+	})
+	defer os.RemoveAll(root)
+
+	values, err := LoadEnvValues(root, []string{"prod-eu"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"region": "eu-west-1", "size": "large"}, values)
+}
+
+func TestLoadEnvValuesWithSource(t *testing.T) {
+	pass := []string{"password"}
+	secret, err := vault.Encrypt([]byte("dbPassword: secret"), pass[0])
+	assert.NoError(t, err)
+
+	root := setupEnvs(t, map[string]string{
+		"default/a.yaml":  "region: ap-southeast-2\ndb:\n  port: 3306\n  host: local",
+		"default/b.yaml":  "region: us-east-1",
+		"prod/vars.yaml":  "region: eu-west-1\ndb:\n  port: 5432",
+		"prod/secret":     string(secret),
+		"prod/zz-db.yaml": "db: external",
+	})
+	defer os.RemoveAll(root)
+
+	values, prov, err := LoadEnvValuesWithSource(root, []string{"prod"}, pass)
+	assert.NoError(t, err)
+	assert.Equal(t, "eu-west-1", values["region"])
+
+	region := prov["region"]
+	assert.Equal(t, filepath.Join(root, "prod/vars.yaml"), region.File)
+	assert.False(t, region.Vault)
+	assert.Equal(t, []string{filepath.Join(root, "default/a.yaml"), filepath.Join(root, "default/b.yaml")}, region.Overrides)
+
+	assert.True(t, prov["dbPassword"].Vault)
+
+	// A scalar replacing a map overrides all values under it
+	db := prov["db"]
+	assert.Equal(t, filepath.Join(root, "prod/zz-db.yaml"), db.File)
+	assert.Contains(t, db.Overrides, filepath.Join(root, "default/a.yaml"))
+	assert.Contains(t, db.Overrides, filepath.Join(root, "prod/vars.yaml"))
+	_, ok := prov["db.port"]
+	assert.False(t, ok)
+}
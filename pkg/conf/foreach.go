@@ -0,0 +1,175 @@
+package conf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"text/template"
+
+	"github.com/google/uuid"
+	"github.com/liangrog/cfctl/pkg/template/funcs"
+)
+
+const (
+	// Key holding the current item of a repeated stack
+	STACK_DATA_ITEM = "item"
+)
+
+// Items a stack is repeated for. Either
+// inline or from an environment value.
+type ForEach struct {
+	// Name of the environment value holding the items
+	Value string
+
+	// Inline items
+	Items []interface{}
+}
+
+// Unmarshal "forEach" from a value name or a list of items
+func (fe *ForEach) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		fe.Value = s
+		return nil
+	}
+
+	var l []valueNode
+	if err := unmarshal(&l); err != nil {
+		return errors.New("forEach must be a value name or a list of items")
+	}
+
+	for _, n := range l {
+		fe.Items = append(fe.Items, n.get())
+	}
+
+	return nil
+}
+
+// Marshal "forEach" back to its original form
+func (fe *ForEach) MarshalYAML() (interface{}, error) {
+	if len(fe.Value) > 0 {
+		return fe.Value, nil
+	}
+
+	return fe.Items, nil
+}
+
+// Return the items to repeat the stack for. Items from
+// a value are empty if no values are given, which is the
+// case when loading the stack file for the first time.
+func (fe *ForEach) getItems(values map[string]interface{}) ([]interface{}, error) {
+	if len(fe.Value) == 0 {
+		return fe.Items, nil
+	}
+
+	if values == nil {
+		return nil, nil
+	}
+
+	v, ok := lookupValue(values, fe.Value)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Value %s isn't defined", fe.Value))
+	}
+
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Value %s isn't a list", fe.Value))
+	}
+
+	return items, nil
+}
+
+// Expand stacks with "forEach" into one stack per item. The name,
+// template, parameter files, parameter directory, tags and dependsOn
+// of the stack are rendered with "[[ ]]" delimiters per item.
+func expandStacks(stacks []*StackConfig, env string, values map[string]interface{}) ([]*StackConfig, error) {
+	var result []*StackConfig
+	for _, sc := range stacks {
+		if sc.ForEach == nil {
+			result = append(result, sc)
+			continue
+		}
+
+		items, err := sc.ForEach.getItems(values)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to expand stack %s: %s", sc.Name, err))
+		}
+
+		for _, item := range items {
+			esc, err := expandStack(sc, env, values, item)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("Failed to expand stack %s: %s", sc.Name, err))
+			}
+
+			result = append(result, esc)
+		}
+	}
+
+	return result, nil
+}
+
+// Return a copy of the stack for given item
+func expandStack(sc *StackConfig, env string, values map[string]interface{}, item interface{}) (*StackConfig, error) {
+	data := configData(env, values)
+	data[STACK_DATA_ITEM] = item
+
+	render := func(s string) (string, error) {
+		tmpl, err := template.New(uuid.New().String()).
+			Delims(DEFERRED_LEFT_DELIM, DEFERRED_RIGHT_DELIM).
+			Funcs(funcs.ValueFuncMap()).
+			Parse(s)
+		if err != nil {
+			return "", err
+		}
+
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, data); err != nil {
+			return "", err
+		}
+
+		return b.String(), nil
+	}
+
+	esc := *sc
+	esc.item = item
+	esc.Tags = nil
+	esc.DependsOn = nil
+
+	var err error
+	for _, f := range []*string{&esc.Name, &esc.Tpl, &esc.ParamDir} {
+		if *f, err = render(*f); err != nil {
+			return nil, err
+		}
+	}
+
+	esc.Param = nil
+	for _, p := range sc.Param {
+		rp, err := render(p)
+		if err != nil {
+			return nil, err
+		}
+
+		esc.Param = append(esc.Param, rp)
+	}
+
+	for k, v := range sc.Tags {
+		if esc.Tags == nil {
+			esc.Tags = make(map[string]string)
+		}
+
+		if esc.Tags[k], err = render(v); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, d := range sc.DependsOn {
+		rd, err := render(d)
+		if err != nil {
+			return nil, err
+		}
+
+		esc.DependsOn = append(esc.DependsOn, rd)
+	}
+
+	return &esc, nil
+}
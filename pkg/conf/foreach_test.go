@@ -0,0 +1,102 @@
+package conf
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForEach(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "foreach")
+	assert.NoError(t, err)
+	defer cleanup(tmpDir)
+
+	writeFiles(t, tmpDir, map[string]string{
+		"stacks.yaml": `
+stacks:
+  - name: vpc
+    tpl: vpc.yaml
+  - name: "{{ .Env }}-az-[[ .item ]]"
+    tpl: subnet.yaml
+    forEach: [a, b]
+    dependsOn:
+      - vpc
+  - name: "tenant-[[ .item.name ]]"
+    tpl: tenant.yaml
+    param: "tenants/[[ .item.name ]].yaml"
+    forEach: tenants
+    tags:
+      Tenant: "[[ .item.name ]]"
+    dependsOn:
+      - "{{ .Env }}-az-a"`,
+	})
+
+	values := map[string]interface{}{
+		"tenants": []interface{}{
+			map[string]interface{}{"name": "acme"},
+			map[string]interface{}{"name": "globex"},
+		},
+	}
+
+	dc, err := NewDeployConfigWithValues(filepath.Join(tmpDir, "stacks.yaml"), "prod", values)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var names []string
+	for _, sc := range dc.GetStacks(nil) {
+		names = append(names, sc.Name)
+	}
+
+	assert.Equal(t, []string{"vpc", "prod-az-a", "prod-az-b", "tenant-acme", "tenant-globex"}, names)
+
+	az := dc.GetStackConfigByName("prod-az-b")
+	assert.Equal(t, "b", az.Item())
+	assert.Equal(t, []string{"vpc"}, az.DependsOn)
+	assert.Equal(t, []interface{}{"a", "b"}, az.ForEach.Items)
+
+	acme := dc.GetStackConfigByName("tenant-acme")
+	assert.Equal(t, ParamFiles{"tenants/acme.yaml"}, acme.Param)
+	assert.Equal(t, map[string]string{"Tenant": "acme"}, acme.Tags)
+	assert.Equal(t, []string{"prod-az-a"}, acme.DependsOn)
+	assert.Equal(t, map[string]interface{}{"name": "acme"}, acme.Values(values)[STACK_DATA_ITEM])
+
+	// Expanded stacks are filtered like other stacks
+	sl := dc.GetStacks(map[string]string{"tag": "Tenant=globex"})
+	assert.Equal(t, 1, len(sl))
+	assert.Equal(t, "tenant-globex", sl[0].Name)
+
+	// Values of stacks not expanded are unchanged
+	assert.Equal(t, values, dc.GetStackConfigByName("vpc").Values(values))
+
+	// Items from values are unknown before values are loaded
+	dc, err = NewDeployConfigWithValues(filepath.Join(tmpDir, "stacks.yaml"), "prod", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(dc.Stacks))
+
+	_, err = NewDeployConfigWithValues(filepath.Join(tmpDir, "stacks.yaml"), "prod", map[string]interface{}{"tenants": "acme"})
+	assert.EqualError(t, err, "Failed to expand stack tenant-[[ .item.name ]]: Value tenants isn't a list")
+
+	_, err = NewDeployConfigWithValues(filepath.Join(tmpDir, "stacks.yaml"), "prod", map[string]interface{}{})
+	assert.EqualError(t, err, "Failed to expand stack tenant-[[ .item.name ]]: Value tenants isn't defined")
+}
+
+func TestForEachDuplicateName(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "foreach")
+	assert.NoError(t, err)
+	defer cleanup(tmpDir)
+
+	writeFiles(t, tmpDir, map[string]string{
+		"stacks.yaml": `
+stacks:
+  - name: app
+    tpl: app.yaml
+    forEach: [a, b]`,
+	})
+
+	_, err = NewDeployConfig(filepath.Join(tmpDir, "stacks.yaml"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Stack app is defined more than once")
+}
@@ -0,0 +1,201 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/liangrog/cfctl/pkg/utils"
+)
+
+// Load all stacks of the config including the ones from
+// included files, with defaults and tags applied and forEach
+// expanded. Stack names must be unique across all files.
+func loadStacks(dc *DeployConfig, file, env string, values map[string]interface{}) ([]*StackConfig, error) {
+	stacks, err := resolveStacks(dc, file, env, values, new(StackConfig), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if stacks, err = expandStacks(stacks, env, values); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]*StackConfig)
+	for _, sc := range stacks {
+		if prev, ok := seen[sc.Name]; ok {
+			return nil, errors.New(fmt.Sprintf("Stack %s is defined more than once, in %s and %s", sc.Name, prev.source, sc.source))
+		}
+
+		seen[sc.Name] = sc
+	}
+
+	return stacks, nil
+}
+
+// Resolve stacks of a config file. Stacks from included files
+// go first in the order of inclusion, followed by the ones in
+// the file. The defaults of a file are merged over the ones of
+// the including file and applied to all stacks of the file.
+func resolveStacks(dc *DeployConfig, file, env string, values map[string]interface{}, parent *StackConfig, chain []string) ([]*StackConfig, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if utils.InSlice(chain, abs) {
+		return nil, errors.New(fmt.Sprintf("Stack file %s has circular include: %s", file, strings.Join(append(chain, abs), " -> ")))
+	}
+
+	chain = append(chain, abs)
+
+	// Global tags are defaults of stack tags
+	defaults := new(StackConfig)
+	if dc.Defaults != nil {
+		*defaults = *dc.Defaults
+	}
+
+	defaults.Tags = mergeTags(dc.Tags, defaults.Tags)
+	applyStackDefaults(defaults, parent)
+
+	var stacks []*StackConfig
+	for _, inc := range dc.Include {
+		files, err := includedFiles(filepath.Dir(file), inc)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range files {
+			idc, err := loadConfigFile(f, env, values)
+			if err != nil {
+				return nil, err
+			}
+
+			sl, err := resolveStacks(idc, f, env, values, defaults, chain)
+			if err != nil {
+				return nil, err
+			}
+
+			stacks = append(stacks, sl...)
+		}
+	}
+
+	for _, sc := range dc.Stacks {
+		if sc == nil {
+			continue
+		}
+
+		applyStackDefaults(sc, defaults)
+		sc.source = file
+
+		stacks = append(stacks, sc)
+	}
+
+	return stacks, nil
+}
+
+// Return the files of an include. The path is relative
+// to the including file's directory and can be a glob.
+func includedFiles(dir, inc string) ([]string, error) {
+	p := inc
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(dir, p)
+	}
+
+	if !strings.ContainsAny(inc, "*?[") {
+		return []string{p}, nil
+	}
+
+	files, err := filepath.Glob(p)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid include %s: %s", inc, err))
+	}
+
+	return files, nil
+}
+
+// Merge tags, the later ones override the earlier ones.
+func mergeTags(tags ...map[string]string) map[string]string {
+	var result map[string]string
+	for _, t := range tags {
+		for k, v := range t {
+			if result == nil {
+				result = make(map[string]string)
+			}
+
+			result[k] = v
+		}
+	}
+
+	return result
+}
+
+// Apply defaults to a stack config. A field not set in the
+// stack takes the default value, a field set to a zero value,
+// e.g. "render: false", keeps it. Maps are merged with the
+// stack's entries overriding the defaults. Name and forEach
+// aren't applied, nor a dependency on the stack itself.
+// Wave and stage are aliases so setting either in the stack
+// keeps both from the defaults.
+func applyStackDefaults(sc, defaults *StackConfig) {
+	sv := reflect.ValueOf(sc).Elem()
+	dv := reflect.ValueOf(defaults).Elem()
+
+	for i := 0; i < sv.NumField(); i++ {
+		field := sv.Type().Field(i)
+
+		// Skip name, forEach and unexported fields
+		if field.Name == "Name" || field.Name == "ForEach" || len(field.PkgPath) > 0 {
+			continue
+		}
+
+		sf, df := sv.Field(i), dv.Field(i)
+		switch {
+		case sf.Kind() == reflect.Map && !df.IsNil():
+			merged := reflect.MakeMap(sf.Type())
+			for _, m := range []reflect.Value{df, sf} {
+				for _, k := range m.MapKeys() {
+					merged.SetMapIndex(k, m.MapIndex(k))
+				}
+			}
+
+			sf.Set(merged)
+		case isZero(sf) && !sc.keys[yamlKey(field)] && !sc.keys[stackKeyAliases[yamlKey(field)]]:
+			sf.Set(df)
+		}
+	}
+
+	if !sc.keys["dependsOn"] && utils.InSlice(sc.DependsOn, sc.Name) {
+		var deps []string
+		for _, d := range sc.DependsOn {
+			if d != sc.Name {
+				deps = append(deps, d)
+			}
+		}
+
+		sc.DependsOn = deps
+	}
+}
+
+// Stack file keys of the same field
+var stackKeyAliases = map[string]string{
+	"wave":  "stage",
+	"stage": "wave",
+}
+
+// Return the key of a field in the stack file
+func yamlKey(field reflect.StructField) string {
+	return strings.Split(field.Tag.Get("yaml"), ",")[0]
+}
+
+// If a value is zero value of its type
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice:
+		return v.Len() == 0
+	}
+
+	return v.IsZero()
+}
@@ -0,0 +1,223 @@
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Write files under given directory
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), os.ModePerm))
+		assert.NoError(t, ioutil.WriteFile(p, []byte(content), 0644))
+	}
+}
+
+func TestInclude(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "include")
+	assert.NoError(t, err)
+	defer cleanup(tmpDir)
+
+	for _, d := range []string{"templates", "env", "param/network"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(tmpDir, d), os.ModePerm))
+	}
+
+	writeFiles(t, tmpDir, map[string]string{
+		"stacks.yaml": `
+s3Bucket: test
+templateDir: templates
+envDir: env
+paramDir: param
+include:
+  - network/stacks.yaml
+  - apps/*.yaml
+tags:
+  Owner: platform
+  Env: {{ .Env }}
+defaults:
+  wave: 1
+stacks:
+  - name: dns
+    tpl: dns.yaml
+    tags:
+      Owner: dns`,
+		"network/stacks.yaml": `
+defaults:
+  paramDir: param/network
+  tags:
+    Team: network
+stacks:
+  - name: vpc
+    tpl: vpc.yaml
+    param: vpc.yaml
+  - name: subnet
+    tpl: subnet.yaml
+    wave: 2`,
+		"apps/a.yaml": `
+stacks:
+  - name: app-a
+    tpl: app.yaml`,
+		"apps/b.yaml": `
+stacks:
+  - name: app-b
+    tpl: app.yaml
+    tags:
+      Env: override`,
+	})
+
+	dc, err := NewDeployConfigWithValues(filepath.Join(tmpDir, "stacks.yaml"), "prod", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Included stacks first in the order of inclusion
+	var names []string
+	for _, sc := range dc.GetStacks(nil) {
+		names = append(names, sc.Name)
+	}
+
+	assert.Equal(t, []string{"vpc", "subnet", "app-a", "app-b", "dns"}, names)
+
+	// Global tags < defaults < stack
+	vpc := dc.GetStackConfigByName("vpc")
+	assert.Equal(t, map[string]string{"Owner": "platform", "Env": "prod", "Team": "network"}, vpc.Tags)
+	assert.Equal(t, map[string]string{"Owner": "dns", "Env": "prod"}, dc.GetStackConfigByName("dns").Tags)
+	assert.Equal(t, map[string]string{"Owner": "platform", "Env": "override"}, dc.GetStackConfigByName("app-b").Tags)
+
+	// Defaults are inherited by included files
+	assert.Equal(t, 1, vpc.GetWave())
+	assert.Equal(t, 2, dc.GetStackConfigByName("subnet").GetWave())
+	assert.Equal(t, 1, dc.GetStackConfigByName("app-a").GetWave())
+
+	// Per stack parameter directory
+	assert.Equal(t, []string{filepath.Join(tmpDir, "param/network/vpc.yaml")}, dc.GetStackParamPaths(vpc))
+	assert.Equal(t, []string{filepath.Join(tmpDir, "param/app.yaml")}, dc.GetStackParamPaths(&StackConfig{Param: ParamFiles{"app.yaml"}}))
+
+	assert.Equal(t, []string{
+		filepath.Join(tmpDir, "network/stacks.yaml"),
+		filepath.Join(tmpDir, "apps/a.yaml"),
+		filepath.Join(tmpDir, "apps/b.yaml"),
+		filepath.Join(tmpDir, "stacks.yaml"),
+	}, dc.GetStackFiles())
+}
+
+func TestStackDefaults(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "include")
+	assert.NoError(t, err)
+	defer cleanup(tmpDir)
+
+	writeFiles(t, tmpDir, map[string]string{
+		"templates/.keep": "",
+		"stacks.yaml": `
+templateDir: templates
+envDir: templates
+paramDir: templates
+include:
+  - other.yaml
+defaults:
+  render: true
+  wave: 2
+  dependsOn: [vpc]
+stacks:
+  - name: vpc
+    tpl: vpc.yaml
+    wave: 1
+  - name: app
+    tpl: app.yaml
+  - name: raw
+    tpl: raw.yaml
+    render: false
+    wave: 0
+    dependsOn: []
+  - name: queue
+    tpl: queue.yaml
+    stage: 3
+  - name: cache
+    tpl: cache.yaml
+    stage: 0`,
+		"other.yaml": `
+defaults:
+  render: false
+stacks:
+  - name: db
+    tpl: db.yaml`,
+	})
+
+	dc, err := NewDeployConfig(filepath.Join(tmpDir, "stacks.yaml"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Defaults don't make a stack depend on itself
+	vpc := dc.GetStackConfigByName("vpc")
+	assert.True(t, vpc.Render)
+	assert.Empty(t, vpc.DependsOn)
+
+	app := dc.GetStackConfigByName("app")
+	assert.True(t, app.Render)
+	assert.Equal(t, 2, app.GetWave())
+	assert.Equal(t, []string{"vpc"}, app.DependsOn)
+
+	// Zero values set explicitly override the defaults
+	raw := dc.GetStackConfigByName("raw")
+	assert.False(t, raw.Render)
+	assert.Equal(t, 0, raw.GetWave())
+	assert.Empty(t, raw.DependsOn)
+
+	// Stage is the same key as wave
+	queue := dc.GetStackConfigByName("queue")
+	assert.Equal(t, 0, queue.Wave)
+	assert.Equal(t, 3, queue.GetWave())
+	assert.Equal(t, 0, dc.GetStackConfigByName("cache").GetWave())
+
+	// So do the ones in defaults of included files
+	db := dc.GetStackConfigByName("db")
+	assert.False(t, db.Render)
+	assert.Equal(t, 2, db.GetWave())
+}
+
+func TestIncludeDuplicateStack(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "include")
+	assert.NoError(t, err)
+	defer cleanup(tmpDir)
+
+	writeFiles(t, tmpDir, map[string]string{
+		"stacks.yaml": `
+include:
+  - other.yaml
+stacks:
+  - name: vpc
+    tpl: vpc.yaml`,
+		"other.yaml": `
+stacks:
+  - name: vpc
+    tpl: vpc.yaml`,
+	})
+
+	_, err = NewDeployConfig(filepath.Join(tmpDir, "stacks.yaml"))
+	assert.EqualError(t, err, "Stack vpc is defined more than once, in "+filepath.Join(tmpDir, "other.yaml")+" and "+filepath.Join(tmpDir, "stacks.yaml"))
+}
+
+func TestIncludeCircular(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "include")
+	assert.NoError(t, err)
+	defer cleanup(tmpDir)
+
+	writeFiles(t, tmpDir, map[string]string{
+		"stacks.yaml": `
+include:
+  - other.yaml`,
+		"other.yaml": `
+include:
+  - stacks.yaml`,
+	})
+
+	_, err = NewDeployConfig(filepath.Join(tmpDir, "stacks.yaml"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "circular include")
+}
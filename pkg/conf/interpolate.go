@@ -0,0 +1,380 @@
+package conf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Return the value paths referenced by given template, e.g.
+// "{{ .db.host }}" references "db.host". References relative
+// to a dot rebound by "range" or "with" are ignored except
+// the ones starting from "$".
+func TemplateRefs(s string, funcMap template.FuncMap) ([]string, error) {
+	return TemplateRefsDelims(s, "", "", funcMap)
+}
+
+// Return the value paths referenced by given template as
+// TemplateRefs does, with given action delimiters.
+func TemplateRefsDelims(s, left, right string, funcMap template.FuncMap) ([]string, error) {
+	tmpl, err := template.New("refs").Delims(left, right).Funcs(funcMap).Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []string
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			walkRefs(t.Tree.Root, true, &refs)
+		}
+	}
+
+	return uniqueStrings(refs), nil
+}
+
+// Collect references from a template node. Fields
+// are only collected if the dot is the root value.
+func walkRefs(node parse.Node, root bool, refs *[]string) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+
+		for _, c := range n.Nodes {
+			walkRefs(c, root, refs)
+		}
+	case *parse.ActionNode:
+		walkRefs(n.Pipe, root, refs)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+
+		for _, c := range n.Cmds {
+			walkRefs(c, root, refs)
+		}
+	case *parse.CommandNode:
+		for _, c := range n.Args {
+			walkRefs(c, root, refs)
+		}
+	case *parse.ChainNode:
+		walkRefs(n.Node, root, refs)
+	case *parse.FieldNode:
+		if root {
+			*refs = append(*refs, strings.Join(n.Ident, "."))
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			*refs = append(*refs, strings.Join(n.Ident[1:], "."))
+		}
+	case *parse.IfNode:
+		walkRefs(n.Pipe, root, refs)
+		walkRefs(n.List, root, refs)
+		walkRefs(n.ElseList, root, refs)
+	case *parse.RangeNode:
+		walkRefs(n.Pipe, root, refs)
+		walkRefs(n.List, false, refs)
+		walkRefs(n.ElseList, root, refs)
+	case *parse.WithNode:
+		walkRefs(n.Pipe, root, refs)
+		walkRefs(n.List, false, refs)
+		walkRefs(n.ElseList, root, refs)
+	case *parse.TemplateNode:
+		walkRefs(n.Pipe, root, refs)
+	}
+}
+
+// Escaped action delimiter in values, rendered as literal "{{"
+const VALUE_ESCAPED_DELIM = `\{{`
+
+// Resolve values that are templates, e.g. "{{ .project }}-artifacts",
+// with the other values and given functions. A value is resolved
+// after all the values it references. Circular references and
+// references to values not defined are errors. "\{{" is a literal
+// "{{" in any value.
+func InterpolateValues(values map[string]interface{}, funcMap template.FuncMap) (map[string]interface{}, error) {
+	return InterpolateValuesWithSource(values, nil, funcMap)
+}
+
+// Resolve values as InterpolateValues does with the sources of
+// the values. Values from vault encrypted files are taken as they
+// are, and the values referencing them are recorded as from vault
+// encrypted files as well so they can be masked.
+func InterpolateValuesWithSource(values map[string]interface{}, prov Provenance, funcMap template.FuncMap) (map[string]interface{}, error) {
+	flat := FlattenValues(values)
+
+	valueRefs, err := ValueTemplateRefsWithSource(values, prov, funcMap)
+	if err != nil {
+		return nil, err
+	}
+
+	deps := make(map[string][]string)
+	for path, refs := range valueRefs {
+		deps[path] = refPaths(flat, refs)
+	}
+
+	// Values not rendered only need unescaping
+	for path, v := range flat {
+		if _, ok := deps[path]; !ok && !prov.isVault(path) {
+			setValue(values, path, unescapeValue(v))
+		}
+	}
+
+	if len(deps) == 0 {
+		return values, nil
+	}
+
+	order, err := interpolationOrder(deps)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range order {
+		v, err := renderValue(flat[path], path, funcMap, values)
+		if err != nil {
+			return nil, err
+		}
+
+		setValue(values, path, v)
+
+		for _, d := range deps[path] {
+			if prov.isVault(d) {
+				prov.markVault(path)
+				break
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// Return the references of templated values
+// keyed by the paths of the templated values.
+func ValueTemplateRefs(values map[string]interface{}, funcMap template.FuncMap) (map[string][]string, error) {
+	return ValueTemplateRefsWithSource(values, nil, funcMap)
+}
+
+// Return the references of templated values as ValueTemplateRefs
+// does. Values from vault encrypted files aren't templates.
+func ValueTemplateRefsWithSource(values map[string]interface{}, prov Provenance, funcMap template.FuncMap) (map[string][]string, error) {
+	result := make(map[string][]string)
+	for path, v := range FlattenValues(values) {
+		if prov.isVault(path) {
+			continue
+		}
+
+		var refs []string
+		for _, s := range templateStrings(v) {
+			r, err := TemplateRefs(escapeDelims(s), funcMap)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("Failed to parse value %s: %s", path, err))
+			}
+
+			refs = append(refs, r...)
+		}
+
+		if len(refs) > 0 {
+			result[path] = uniqueStrings(refs)
+		}
+	}
+
+	return result, nil
+}
+
+// If a string is a template. Escaped delimiters don't count.
+func isTemplateValue(s string) bool {
+	return strings.Contains(strings.ReplaceAll(s, VALUE_ESCAPED_DELIM, ""), "{{")
+}
+
+// Turn escaped delimiters into template actions
+// printing the delimiters.
+func escapeDelims(s string) string {
+	return strings.ReplaceAll(s, VALUE_ESCAPED_DELIM, `{{ "{{" }}`)
+}
+
+// Replace escaped delimiters with literal ones
+func unescapeValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case string:
+		return strings.ReplaceAll(val, VALUE_ESCAPED_DELIM, "{{")
+	case []interface{}:
+		list := make([]interface{}, len(val))
+		for i, item := range val {
+			list[i] = unescapeValue(item)
+		}
+
+		return list
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			m[k] = unescapeValue(item)
+		}
+
+		return m
+	}
+
+	return v
+}
+
+// Return the templates in given value. Lists
+// are searched for templates in their items.
+func templateStrings(v interface{}) []string {
+	switch val := v.(type) {
+	case string:
+		if isTemplateValue(val) {
+			return []string{val}
+		}
+	case []interface{}:
+		var result []string
+		for _, item := range val {
+			result = append(result, templateStrings(item)...)
+		}
+
+		return result
+	case map[string]interface{}:
+		var result []string
+		for _, item := range val {
+			result = append(result, templateStrings(item)...)
+		}
+
+		return result
+	}
+
+	return nil
+}
+
+// Map references to the leaf value paths. Referencing
+// a map depends on all the values under it.
+func refPaths(flat map[string]interface{}, refs []string) []string {
+	var paths []string
+	for p := range flat {
+		for _, r := range refs {
+			if pathsOverlap(p, r) {
+				paths = append(paths, p)
+				break
+			}
+		}
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
+
+// Sort templated values so the ones being referenced go first.
+func interpolationOrder(deps map[string][]string) ([]string, error) {
+	var keys []string
+	for k := range deps {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	var order []string
+	done := make(map[string]bool)
+
+	var visit func(path []string) error
+	visit = func(path []string) error {
+		k := path[len(path)-1]
+		if done[k] {
+			return nil
+		}
+
+		for i, p := range path[:len(path)-1] {
+			if p == k {
+				return errors.New(fmt.Sprintf("Value %s has circular reference: %s", k, strings.Join(path[i:], " -> ")))
+			}
+		}
+
+		for _, d := range deps[k] {
+			if err := visit(append(path[:len(path):len(path)], d)); err != nil {
+				return err
+			}
+		}
+
+		done[k] = true
+		if _, ok := deps[k]; ok {
+			order = append(order, k)
+		}
+
+		return nil
+	}
+
+	for _, k := range keys {
+		if err := visit([]string{k}); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// Render templates in given value
+func renderValue(v interface{}, path string, funcMap template.FuncMap, data map[string]interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case string:
+		if !isTemplateValue(val) {
+			return unescapeValue(val), nil
+		}
+
+		tmpl, err := template.New(path).Option("missingkey=error").Funcs(funcMap).Parse(escapeDelims(val))
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to parse value %s: %s", path, err))
+		}
+
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, data); err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to resolve value %s: %s", path, err))
+		}
+
+		return b.String(), nil
+	case []interface{}:
+		list := make([]interface{}, len(val))
+		for i, item := range val {
+			r, err := renderValue(item, path, funcMap, data)
+			if err != nil {
+				return nil, err
+			}
+
+			list[i] = r
+		}
+
+		return list, nil
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			r, err := renderValue(item, path, funcMap, data)
+			if err != nil {
+				return nil, err
+			}
+
+			m[k] = r
+		}
+
+		return m, nil
+	}
+
+	return v, nil
+}
+
+// Set value of given dot delimited path
+func setValue(values map[string]interface{}, path string, v interface{}) {
+	parts := strings.Split(path, ".")
+
+	m := values
+	for _, p := range parts[:len(parts)-1] {
+		sub, ok := m[p].(map[string]interface{})
+		if !ok {
+			return
+		}
+
+		m = sub
+	}
+
+	m[parts[len(parts)-1]] = v
+}
@@ -0,0 +1,225 @@
+package conf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/liangrog/cfctl/pkg/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// Keys of CodePipeline template configuration file
+const (
+	PARAMS_KEY_PARAMETERS   = "Parameters"
+	PARAMS_KEY_TAGS         = "Tags"
+	PARAMS_KEY_STACK_POLICY = "StackPolicy"
+)
+
+// Stack parameters decoded from a parameter file
+type StackParams struct {
+	// Parameter values
+	Parameters map[string]string
+
+	// Stack tags
+	Tags map[string]string
+
+	// Stack policy body in JSON
+	StackPolicy string
+
+	// Parameters keeping their previous values
+	UsePreviousValue []string
+}
+
+// Create empty stack parameters
+func NewStackParams() *StackParams {
+	return &StackParams{
+		Parameters: make(map[string]string),
+		Tags:       make(map[string]string),
+	}
+}
+
+// Merge other parameters over these ones
+func (sp *StackParams) Merge(other *StackParams) {
+	for k, v := range other.Parameters {
+		sp.Parameters[k] = v
+	}
+
+	for k, v := range other.Tags {
+		sp.Tags[k] = v
+	}
+
+	if len(other.StackPolicy) > 0 {
+		sp.StackPolicy = other.StackPolicy
+	}
+
+	for _, k := range other.UsePreviousValue {
+		if !utils.InSlice(sp.UsePreviousValue, k) {
+			sp.UsePreviousValue = append(sp.UsePreviousValue, k)
+		}
+	}
+}
+
+// Parameter in the format of AWS CLI
+type cliParam struct {
+	ParameterKey     string `yaml:"ParameterKey"`
+	ParameterValue   string `yaml:"ParameterValue"`
+	UsePreviousValue bool   `yaml:"UsePreviousValue"`
+}
+
+// CodePipeline template configuration
+type pipelineConfig struct {
+	Parameters  map[string]string `yaml:"Parameters"`
+	Tags        map[string]string `yaml:"Tags"`
+	StackPolicy interface{}       `yaml:"StackPolicy"`
+}
+
+// Decode a rendered parameter file. Three formats are accepted:
+//
+//	Key: value
+//	[{"ParameterKey": "Key", "ParameterValue": "value"}]
+//	{"Parameters": {"Key": "value"}, "Tags": {...}, "StackPolicy": {...}}
+//
+// The second is the format of AWS CLI and the last one is
+// CodePipeline template configuration file. JSON is accepted
+// for all of them as well as YAML. Values are kept in their
+// original text, e.g. "1.10" isn't turned into "1.1".
+func DecodeStackParams(dat []byte) (*StackParams, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(dat, &doc); err != nil {
+		return nil, err
+	}
+
+	sp := NewStackParams()
+
+	switch d := doc.(type) {
+	case nil:
+		return sp, nil
+	case []interface{}:
+		return sp, decodeCliParams(sp, dat)
+	case map[interface{}]interface{}:
+		if isPipelineConfig(d) {
+			return sp, decodePipelineConfig(sp, dat)
+		}
+
+		if err := yaml.Unmarshal(dat, &sp.Parameters); err != nil {
+			return nil, err
+		}
+
+		return sp, nil
+	}
+
+	return nil, errors.New("Parameters must be a map or a list of ParameterKey and ParameterValue")
+}
+
+// If the document is a CodePipeline template configuration,
+// i.e. it has a "Parameters" map and no other keys than
+// "Parameters", "Tags" and "StackPolicy".
+func isPipelineConfig(d map[interface{}]interface{}) bool {
+	if _, ok := d[PARAMS_KEY_PARAMETERS].(map[interface{}]interface{}); !ok {
+		return false
+	}
+
+	for k := range d {
+		switch k {
+		case PARAMS_KEY_PARAMETERS, PARAMS_KEY_TAGS, PARAMS_KEY_STACK_POLICY:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// Decode AWS CLI parameter list
+func decodeCliParams(sp *StackParams, dat []byte) error {
+	var l []cliParam
+	if err := yaml.Unmarshal(dat, &l); err != nil {
+		return err
+	}
+
+	for i, p := range l {
+		if len(p.ParameterKey) == 0 {
+			return errors.New(fmt.Sprintf("Parameter %d has no ParameterKey", i+1))
+		}
+
+		if p.UsePreviousValue {
+			sp.UsePreviousValue = append(sp.UsePreviousValue, p.ParameterKey)
+			continue
+		}
+
+		sp.Parameters[p.ParameterKey] = p.ParameterValue
+	}
+
+	return nil
+}
+
+// Decode CodePipeline template configuration
+func decodePipelineConfig(sp *StackParams, dat []byte) error {
+	var pc pipelineConfig
+	if err := yaml.Unmarshal(dat, &pc); err != nil {
+		return err
+	}
+
+	sp.Merge(&StackParams{Parameters: pc.Parameters, Tags: pc.Tags})
+
+	switch policy := pc.StackPolicy.(type) {
+	case nil:
+	case string:
+		if !json.Valid([]byte(policy)) {
+			return errors.New("Invalid StackPolicy: must be a JSON document")
+		}
+
+		sp.StackPolicy = policy
+	default:
+		b, err := json.Marshal(jsonValue(policy))
+		if err != nil {
+			return errors.New(fmt.Sprintf("Invalid StackPolicy: %s", err))
+		}
+
+		sp.StackPolicy = string(b)
+	}
+
+	return nil
+}
+
+// Convert a yaml value to be marshalled as JSON
+func jsonValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, sv := range val {
+			m[fmt.Sprint(k)] = jsonValue(sv)
+		}
+
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(val))
+		for i, sv := range val {
+			l[i] = jsonValue(sv)
+		}
+
+		return l
+	}
+
+	return v
+}
+
+// Return CodePipeline template configuration of the parameters,
+// which is also accepted by "aws cloudformation deploy" as
+// "--parameter-overrides file://params.json".
+func (sp *StackParams) PipelineConfig() map[string]interface{} {
+	config := map[string]interface{}{
+		PARAMS_KEY_PARAMETERS: sp.Parameters,
+	}
+
+	if len(sp.Tags) > 0 {
+		config[PARAMS_KEY_TAGS] = sp.Tags
+	}
+
+	if len(sp.StackPolicy) > 0 {
+		config[PARAMS_KEY_STACK_POLICY] = json.RawMessage(sp.StackPolicy)
+	}
+
+	return config
+}
@@ -0,0 +1,82 @@
+package conf
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeStackParams(t *testing.T) {
+	// Flat map
+	sp, err := DecodeStackParams([]byte("VpcId: vpc-1\nVersion: 1.10\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"VpcId": "vpc-1", "Version": "1.10"}, sp.Parameters)
+	assert.Empty(t, sp.Tags)
+
+	// AWS CLI format
+	sp, err = DecodeStackParams([]byte(`[
+  {"ParameterKey": "VpcId", "ParameterValue": "vpc-1"},
+  {"ParameterKey": "Size", "ParameterValue": 3},
+  {"ParameterKey": "DbPassword", "UsePreviousValue": true}
+]`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"VpcId": "vpc-1", "Size": "3"}, sp.Parameters)
+	assert.Equal(t, []string{"DbPassword"}, sp.UsePreviousValue)
+
+	_, err = DecodeStackParams([]byte(`[{"ParameterValue": "vpc-1"}]`))
+	assert.EqualError(t, err, "Parameter 1 has no ParameterKey")
+
+	// CodePipeline format
+	sp, err = DecodeStackParams([]byte(`{
+  "Parameters": {"VpcId": "vpc-1"},
+  "Tags": {"Team": "web"},
+  "StackPolicy": {"Statement": [{"Effect": "Allow", "Action": "Update:*", "Principal": "*", "Resource": "*"}]}
+}`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"VpcId": "vpc-1"}, sp.Parameters)
+	assert.Equal(t, map[string]string{"Team": "web"}, sp.Tags)
+	assert.JSONEq(t, `{"Statement": [{"Effect": "Allow", "Action": "Update:*", "Principal": "*", "Resource": "*"}]}`, sp.StackPolicy)
+
+	// A parameter named "Parameters" in a flat map
+	sp, err = DecodeStackParams([]byte("Parameters: a\nVpcId: vpc-1\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"Parameters": "a", "VpcId": "vpc-1"}, sp.Parameters)
+
+	_, err = DecodeStackParams([]byte(`{"Parameters": {"A": "b"}, "StackPolicy": "not json"}`))
+	assert.Error(t, err)
+
+	sp, err = DecodeStackParams([]byte(""))
+	assert.NoError(t, err)
+	assert.Empty(t, sp.Parameters)
+
+	_, err = DecodeStackParams([]byte("just text"))
+	assert.Error(t, err)
+}
+
+func TestStackParamsMerge(t *testing.T) {
+	sp := NewStackParams()
+	sp.Merge(&StackParams{Parameters: map[string]string{"A": "1", "B": "1"}, UsePreviousValue: []string{"P"}})
+	sp.Merge(&StackParams{Parameters: map[string]string{"B": "2"}, Tags: map[string]string{"T": "x"}, StackPolicy: "{}", UsePreviousValue: []string{"P", "Q"}})
+
+	assert.Equal(t, map[string]string{"A": "1", "B": "2"}, sp.Parameters)
+	assert.Equal(t, map[string]string{"T": "x"}, sp.Tags)
+	assert.Equal(t, "{}", sp.StackPolicy)
+	assert.Equal(t, []string{"P", "Q"}, sp.UsePreviousValue)
+}
+
+func TestPipelineConfig(t *testing.T) {
+	sp := NewStackParams()
+	sp.Parameters["VpcId"] = "vpc-1"
+
+	b, err := json.Marshal(sp.PipelineConfig())
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"Parameters": {"VpcId": "vpc-1"}}`, string(b))
+
+	sp.Tags["Team"] = "web"
+	sp.StackPolicy = `{"Statement": []}`
+
+	b, err = json.Marshal(sp.PipelineConfig())
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"Parameters": {"VpcId": "vpc-1"}, "Tags": {"Team": "web"}, "StackPolicy": {"Statement": []}}`, string(b))
+}
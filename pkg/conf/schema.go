@@ -0,0 +1,283 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/liangrog/cfctl/pkg/utils"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// Default values schema file name. It sits
+	// in the same directory as the envDir.
+	DEFAULT_VALUES_SCHEMA_FILE_NAME = "values.schema.yaml"
+)
+
+// Value types in values schema
+const (
+	ValueTypeString  = "string"
+	ValueTypeNumber  = "number"
+	ValueTypeInteger = "integer"
+	ValueTypeBoolean = "boolean"
+	ValueTypeList    = "list"
+	ValueTypeMap     = "map"
+)
+
+// Rule for a value in values schema
+type ValueRule struct {
+	// If the value must be defined
+	Required bool `yaml:"required,omitempty"`
+
+	// Value type
+	Type string `yaml:"type,omitempty"`
+
+	// Regular expression the value must match
+	Pattern string `yaml:"pattern,omitempty"`
+
+	// Allowed values
+	Allowed []string `yaml:"allowed,omitempty"`
+
+	// Description of the value
+	Description string `yaml:"description,omitempty"`
+
+	// Compiled pattern
+	re *regexp.Regexp
+}
+
+// Values schema keyed by value path,
+// e.g. "db.port" for nested value.
+type ValuesSchema map[string]*ValueRule
+
+// A value failing the schema
+type ValueError struct {
+	Key     string `json:"key" yaml:"key"`
+	Message string `json:"message" yaml:"message"`
+}
+
+// Load values schema from file. If the file
+// doesn't exist, nil schema is returned.
+func LoadValuesSchema(path string) (ValuesSchema, error) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	schema := make(ValuesSchema)
+	if err := yaml.UnmarshalStrict(dat, &schema); err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to parse values schema %s: %s", path, err))
+	}
+
+	for k, rule := range schema {
+		if rule == nil {
+			schema[k] = new(ValueRule)
+			continue
+		}
+
+		switch rule.Type {
+		case "", ValueTypeString, ValueTypeNumber, ValueTypeInteger, ValueTypeBoolean, ValueTypeList, ValueTypeMap:
+		default:
+			return nil, errors.New(fmt.Sprintf("Invalid type %s for value %s in values schema %s", rule.Type, k, path))
+		}
+
+		if len(rule.Pattern) > 0 {
+			if rule.re, err = regexp.Compile(rule.Pattern); err != nil {
+				return nil, errors.New(fmt.Sprintf("Invalid pattern for value %s in values schema %s: %s", k, path, err))
+			}
+		}
+	}
+
+	return schema, nil
+}
+
+// Validate values against the schema. All
+// errors are returned sorted by value key.
+func (s ValuesSchema) Validate(values map[string]interface{}) []*ValueError {
+	var errs []*ValueError
+
+	for k, rule := range s {
+		v, ok := lookupValue(values, k)
+		if !ok {
+			if rule.Required {
+				errs = append(errs, &ValueError{Key: k, Message: "is required but not defined"})
+			}
+
+			continue
+		}
+
+		for _, msg := range rule.check(v) {
+			errs = append(errs, &ValueError{Key: k, Message: msg})
+		}
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Key < errs[j].Key })
+
+	return errs
+}
+
+// Check a value against the rule
+func (r *ValueRule) check(v interface{}) []string {
+	var msgs []string
+
+	_, isList := v.([]interface{})
+	_, isMap := v.(map[string]interface{})
+
+	switch r.Type {
+	case ValueTypeList:
+		if !isList {
+			return []string{"must be a list"}
+		}
+	case ValueTypeMap:
+		if !isMap {
+			return []string{"must be a map"}
+		}
+	case ValueTypeString, ValueTypeNumber, ValueTypeInteger, ValueTypeBoolean:
+		s, ok := v.(string)
+		if !ok {
+			return []string{fmt.Sprintf("must be of type %s", r.Type)}
+		}
+
+		if !isValueType(s, r.Type) {
+			msgs = append(msgs, fmt.Sprintf("must be of type %s, got '%s'", r.Type, s))
+		}
+	}
+
+	// Pattern and allowed values apply to
+	// a scalar or every item of a list.
+	var items []string
+	switch val := v.(type) {
+	case string:
+		items = []string{val}
+	case []interface{}:
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				items = append(items, s)
+			}
+		}
+	}
+
+	for _, s := range items {
+		if r.re != nil && !r.re.MatchString(s) {
+			msgs = append(msgs, fmt.Sprintf("'%s' doesn't match pattern %s", s, r.Pattern))
+		}
+
+		if len(r.Allowed) > 0 && !utils.InSlice(r.Allowed, s) {
+			msgs = append(msgs, fmt.Sprintf("'%s' isn't one of allowed values: %s", s, strings.Join(r.Allowed, ", ")))
+		}
+	}
+
+	return msgs
+}
+
+// If a scalar value is of given type
+func isValueType(s, t string) bool {
+	var err error
+
+	switch t {
+	case ValueTypeNumber:
+		_, err = strconv.ParseFloat(s, 64)
+	case ValueTypeInteger:
+		_, err = strconv.ParseInt(s, 10, 64)
+	case ValueTypeBoolean:
+		_, err = strconv.ParseBool(s)
+	}
+
+	return err == nil
+}
+
+// Get a value by its dot delimited path
+func lookupValue(values map[string]interface{}, path string) (interface{}, bool) {
+	var v interface{} = values
+	for _, p := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		if v, ok = m[p]; !ok {
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+// If two value paths refer to the same value or one
+// is under the other, e.g. "db" and "db.port".
+func pathsOverlap(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+".") || strings.HasPrefix(b, a+".")
+}
+
+// Value references and the files referencing them
+type ValueRefs map[string][]string
+
+// Add references found in given file
+func (r ValueRefs) Add(file string, refs []string) {
+	for _, ref := range refs {
+		if !utils.InSlice(r[ref], file) {
+			r[ref] = append(r[ref], file)
+		}
+	}
+}
+
+// A reference and where it's from
+type ValueRef struct {
+	Key   string   `json:"key" yaml:"key"`
+	Files []string `json:"files" yaml:"files"`
+}
+
+// Return the references not defined in given values
+func (r ValueRefs) Undefined(values map[string]interface{}) []*ValueRef {
+	flat := FlattenValues(values)
+
+	var undefined []*ValueRef
+	for ref, files := range r {
+		defined := false
+		for p := range flat {
+			if pathsOverlap(p, ref) {
+				defined = true
+				break
+			}
+		}
+
+		if !defined {
+			undefined = append(undefined, &ValueRef{Key: ref, Files: files})
+		}
+	}
+
+	sort.Slice(undefined, func(i, j int) bool { return undefined[i].Key < undefined[j].Key })
+
+	return undefined
+}
+
+// Return the leaf values never referenced
+func (r ValueRefs) Unused(values map[string]interface{}) []string {
+	var unused []string
+	for p := range FlattenValues(values) {
+		used := false
+		for ref := range r {
+			if pathsOverlap(p, ref) {
+				used = true
+				break
+			}
+		}
+
+		if !used {
+			unused = append(unused, p)
+		}
+	}
+
+	sort.Strings(unused)
+
+	return unused
+}
@@ -0,0 +1,122 @@
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadValuesSchema(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	p := filepath.Join(tmpDir, DEFAULT_VALUES_SCHEMA_FILE_NAME)
+
+	// Optional
+	schema, err := LoadValuesSchema(p)
+	assert.NoError(t, err)
+	assert.Nil(t, schema)
+
+	assert.NoError(t, ioutil.WriteFile(p, []byte(`
+vpcCidr:
+  required: true
+  pattern: "^10\\."
+db.port:
+  type: integer
+optional:
+`), 0644))
+
+	schema, err = LoadValuesSchema(p)
+	assert.NoError(t, err)
+	assert.Len(t, schema, 3)
+	assert.True(t, schema["vpcCidr"].Required)
+	assert.Equal(t, ValueTypeInteger, schema["db.port"].Type)
+	assert.NotNil(t, schema["optional"])
+
+	assert.NoError(t, ioutil.WriteFile(p, []byte("a:\n  type: float"), 0644))
+	_, err = LoadValuesSchema(p)
+	assert.Error(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(p, []byte("a:\n  pattern: \"[\""), 0644))
+	_, err = LoadValuesSchema(p)
+	assert.Error(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(p, []byte("a:\n  unknown: true"), 0644))
+	_, err = LoadValuesSchema(p)
+	assert.Error(t, err)
+}
+
+func TestValuesSchemaValidate(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	p := filepath.Join(tmpDir, DEFAULT_VALUES_SCHEMA_FILE_NAME)
+	assert.NoError(t, ioutil.WriteFile(p, []byte(`
+vpcCidr:
+  required: true
+  pattern: "^10\\."
+missing:
+  required: true
+optional:
+  type: string
+db.port:
+  type: integer
+enabled:
+  type: boolean
+subnets:
+  type: list
+  allowed: [a, b]
+size:
+  allowed: [small, large]
+db:
+  type: map
+`), 0644))
+
+	schema, err := LoadValuesSchema(p)
+	assert.NoError(t, err)
+
+	errs := schema.Validate(map[string]interface{}{
+		"vpcCidr": "192.168.0.0/16",
+		"db":      map[string]interface{}{"port": "abc"},
+		"enabled": "true",
+		"subnets": []interface{}{"a", "c"},
+		"size":    "small",
+	})
+
+	assert.Equal(t, []*ValueError{
+		{Key: "db.port", Message: "must be of type integer, got 'abc'"},
+		{Key: "missing", Message: "is required but not defined"},
+		{Key: "subnets", Message: "'c' isn't one of allowed values: a, b"},
+		{Key: "vpcCidr", Message: `'192.168.0.0/16' doesn't match pattern ^10\.`},
+	}, errs)
+
+	errs = schema.Validate(map[string]interface{}{
+		"vpcCidr": "10.0.0.0/16",
+		"missing": "",
+		"db":      "not a map",
+	})
+
+	assert.Equal(t, []*ValueError{{Key: "db", Message: "must be a map"}}, errs)
+}
+
+func TestValueRefs(t *testing.T) {
+	refs := make(ValueRefs)
+	refs.Add("a.yaml", []string{"project", "db.host"})
+	refs.Add("b.yaml", []string{"project", "undefined", "subnets"})
+	refs.Add("b.yaml", []string{"undefined"})
+
+	values := map[string]interface{}{
+		"project": "shop",
+		"db":      map[string]interface{}{"host": "localhost", "port": "3306"},
+		"subnets": []interface{}{"a"},
+		"unused":  "1",
+	}
+
+	assert.Equal(t, []*ValueRef{{Key: "undefined", Files: []string{"b.yaml"}}}, refs.Undefined(values))
+	assert.Equal(t, []string{"db.port", "unused"}, refs.Unused(values))
+}
@@ -1,8 +1,11 @@
 package conf
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strconv"
 	"testing"
 	"time"
@@ -63,3 +66,133 @@ func TestLoadVaules(t *testing.T) {
 	// Clean up
 	os.RemoveAll(tmpDir)
 }
+
+func TestLoadNestedValues(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test"+strconv.FormatInt(time.Now().Unix(), 10))
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string]string{
+		"a.yaml": `
+port: 8080
+zip: 0123
+enabled: true
+empty:
+subnets:
+  - subnet-a
+  - subnet-b
+db:
+  host: localhost
+  port: 3306`,
+		"b.yaml": `
+db:
+  port: 5432
+subnets:
+  - subnet-c`,
+	}
+
+	for name, content := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644))
+	}
+
+	result, err := LoadValues(tmpDir, nil)
+	assert.NoError(t, err)
+
+	// Scalars keep behaving as plain strings
+	assert.Equal(t, "8080", result["port"])
+	assert.Equal(t, "0123", result["zip"])
+	assert.Equal(t, "true", result["enabled"])
+	assert.Equal(t, "", result["empty"])
+
+	// Lists are replaced and maps are merged
+	assert.Equal(t, []interface{}{"subnet-c"}, result["subnets"])
+	assert.Equal(t, map[string]interface{}{"host": "localhost", "port": "5432"}, result["db"])
+}
+
+func TestLoadValuesErrors(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test"+strconv.FormatInt(time.Now().Unix(), 10))
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	enc, err := vault.Encrypt([]byte("secret: a"), "right")
+	assert.NoError(t, err)
+
+	// More broken files than workers
+	for i := 0; i < 30; i++ {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, fmt.Sprintf("secret%d.yaml", i)), enc, 0644))
+	}
+
+	before := runtime.NumGoroutine()
+
+	_, err = LoadValues(tmpDir, []string{"wrong"})
+	assert.Error(t, err)
+
+	// Workers stop after the first error
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, runtime.NumGoroutine() <= before)
+}
+
+func TestMergeValues(t *testing.T) {
+	target := map[string]interface{}{
+		"a": "1",
+		"m": map[string]interface{}{"x": "1", "y": "1"},
+		"s": map[string]interface{}{"x": "1"},
+	}
+
+	replace := map[string]interface{}{
+		"b": "2",
+		"m": map[string]interface{}{"y": "2"},
+		"s": "scalar",
+	}
+
+	result := MergeValues(target, replace)
+	assert.Equal(t, map[string]interface{}{
+		"a": "1",
+		"b": "2",
+		"m": map[string]interface{}{"x": "1", "y": "2"},
+		"s": "scalar",
+	}, result)
+
+	assert.Equal(t, replace, MergeValues(nil, replace))
+}
+
+func TestFlattenValues(t *testing.T) {
+	flat := FlattenValues(map[string]interface{}{
+		"a":  "1",
+		"db": map[string]interface{}{"port": "3306", "opts": map[string]interface{}{"ssl": "true"}},
+		"l":  []interface{}{"x"},
+	})
+
+	assert.Equal(t, map[string]interface{}{
+		"a":           "1",
+		"db.port":     "3306",
+		"db.opts.ssl": "true",
+		"l":           []interface{}{"x"},
+	}, flat)
+}
+
+func TestDiffValues(t *testing.T) {
+	from := map[string]interface{}{
+		"a":  "1",
+		"b":  "2",
+		"db": map[string]interface{}{"port": "3306"},
+		"l":  []interface{}{"x"},
+	}
+
+	to := map[string]interface{}{
+		"a":  "1",
+		"c":  "3",
+		"db": map[string]interface{}{"port": "5432"},
+		"l":  []interface{}{"x"},
+	}
+
+	assert.Equal(t, []*ValueDiff{
+		{Key: "b", Type: ValueDiffRemoved, From: "2"},
+		{Key: "c", Type: ValueDiffAdded, To: "3"},
+		{Key: "db.port", Type: ValueDiffChanged, From: "3306", To: "5432"},
+	}, DiffValues(from, to))
+
+	assert.Equal(t, 0, len(DiffValues(from, from)))
+}
@@ -1,73 +1,155 @@
 package conf
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"path/filepath"
+	"reflect"
 	"sort"
+	"strings"
 	"sync"
 
 	"github.com/liangrog/cfctl/pkg/utils"
 	"github.com/liangrog/vault"
-	"gopkg.in/yaml.v2"
 )
 
 // Result for value read
 type valueResult struct {
 	path   string
-	values map[string]string
+	values map[string]interface{}
+	vault  bool
 	err    error
 }
 
-// Processing given files into key-values
-func processValue(passwords []string, paths <-chan string, out chan<- *valueResult, done <-chan bool) {
-	var v *valueResult
-	var tv map[string]string
+// A node in a value file. Scalars are kept in their original
+// text so they behave the same as plain string values. Lists
+// and maps are kept as trees so they can be used in templates.
+type valueNode struct {
+	value interface{}
+}
 
-	for p := range paths {
-		dat, err := ioutil.ReadFile(p)
-		if err != nil {
-			v = &valueResult{err: err}
+// Unmarshal a yaml node into scalar, list or map.
+func (n *valueNode) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		n.value = s
+		return nil
+	}
+
+	var l []valueNode
+	if err := unmarshal(&l); err == nil {
+		list := make([]interface{}, len(l))
+		for i, v := range l {
+			list[i] = v.get()
 		}
-		// If it's vault encrypted file, decrypt it
-		if vault.HasVaultHeader(dat) {
-			decrypted := false
-			for _, pass := range passwords {
-				if dat, err = vault.Decrypt(pass, dat); err == nil {
-					// If found one password that works.
-					decrypted = true
-					break
-				}
-			}
 
-			// If there is a problem, don't continue
-			if !decrypted {
-				out <- &valueResult{err: err}
-				continue
-			}
+		n.value = list
+		return nil
+	}
+
+	var m map[string]valueNode
+	if err := unmarshal(&m); err != nil {
+		return err
+	}
+
+	n.value = nodeMap(m)
+
+	return nil
+}
+
+// Return the node value. Null is
+// returned as empty string.
+func (n valueNode) get() interface{} {
+	if n.value == nil {
+		return ""
+	}
+
+	return n.value
+}
+
+// Convert nodes to a value map
+func nodeMap(m map[string]valueNode) map[string]interface{} {
+	values := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		values[k] = v.get()
+	}
+
+	return values
+}
+
+// Processing given files into key-values
+func processValue(passwords []string, paths <-chan string, out chan<- *valueResult, done <-chan bool) {
+	for p := range paths {
+		// Environment meta file isn't a value file
+		if filepath.Base(p) == ENV_META_FILE_NAME {
+			continue
 		}
 
-		// Keep overriding the same map
-		err = yaml.Unmarshal([]byte(dat), &tv)
-		if err != nil {
-			v = &valueResult{err: err}
-		} else {
-			v = &valueResult{
-				path:   p,
-				values: tv,
-			}
+		// Ignore dotfiles and files with unknown extension
+		decode := getValueDecoder(p)
+		if decode == nil {
+			continue
 		}
 
+		// Stop when the result isn't wanted any more,
+		// e.g. another file has failed.
 		select {
-		case out <- v:
+		case out <- loadValueFile(passwords, p, decode):
 		case <-done:
 			return
 		}
 	}
 }
 
+// Load a value file. It's decrypted if vault encrypted.
+func loadValueFile(passwords []string, p string, decode valueDecoder) *valueResult {
+	dat, err := ioutil.ReadFile(p)
+	if err != nil {
+		return &valueResult{err: err}
+	}
+
+	// If it's vault encrypted file, decrypt it
+	encrypted := vault.HasVaultHeader(dat)
+	if encrypted {
+		decrypted := false
+		for _, pass := range passwords {
+			if dat, err = vault.Decrypt(pass, dat); err == nil {
+				// If found one password that works.
+				decrypted = true
+				break
+			}
+		}
+
+		// If there is a problem, don't continue
+		if !decrypted {
+			return &valueResult{err: err}
+		}
+	}
+
+	values, err := decode(dat)
+	if err != nil {
+		return &valueResult{err: errors.New(fmt.Sprintf("Failed to parse value file %s: %s", p, err))}
+	}
+
+	return &valueResult{
+		path:   p,
+		values: values,
+		vault:  encrypted,
+	}
+}
+
 // Load Values from value directories.
 // The order of value override is always following
 // the lexical order of the file names
-func LoadValues(root string, passwords []string) (map[string]string, error) {
+func LoadValues(root string, passwords []string) (map[string]interface{}, error) {
+	values, _, err := LoadValuesWithSource(root, passwords)
+	return values, err
+}
+
+// Load values from value directories as LoadValues does.
+// It also returns where each value comes from.
+func LoadValuesWithSource(root string, passwords []string) (map[string]interface{}, Provenance, error) {
 	// Find all files in paths
 	done := make(chan bool)
 	defer close(done)
@@ -96,17 +178,17 @@ func LoadValues(root string, passwords []string) (map[string]string, error) {
 
 	// Processing output
 
-	m := make(map[string]map[string]string)
+	m := make(map[string]*valueResult)
 	for vr := range c {
 		if vr.err != nil {
-			return nil, vr.err
+			return nil, nil, vr.err
 		}
-		m[vr.path] = vr.values
+		m[vr.path] = vr
 	}
 
 	// Check whether the file scan failed.
 	if err := <-errc; err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Get keys
@@ -116,24 +198,178 @@ func LoadValues(root string, passwords []string) (map[string]string, error) {
 	}
 
 	// Merge values
-	var values map[string]string
+	values := make(map[string]interface{})
+	prov := make(Provenance)
 	sort.Strings(keys)
 	for _, k := range keys {
-		values = MergeValues(values, m[k])
+		values = MergeValues(values, m[k].values)
+		prov.Record(&ValueSource{File: k, Vault: m[k].vault}, m[k].values)
 	}
 
-	return values, nil
+	return values, prov, nil
 }
 
-// Merge two maps
-func MergeValues(target, replace map[string]string) map[string]string {
+// Merge two value trees. Maps are merged
+// recursively and other values are replaced.
+func MergeValues(target, replace map[string]interface{}) map[string]interface{} {
 	if target == nil {
 		return replace
 	}
 
 	for k, v := range replace {
-		target[k] = v
+		tm, tok := target[k].(map[string]interface{})
+		rm, rok := v.(map[string]interface{})
+		if tok && rok {
+			target[k] = MergeValues(tm, rm)
+		} else {
+			target[k] = v
+		}
 	}
 
 	return target
 }
+
+// Flatten value tree into leaf values keyed by
+// their paths joined by dot, e.g. "db.port".
+func FlattenValues(values map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{})
+
+	var walk func(prefix string, m map[string]interface{})
+	walk = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			if sub, ok := v.(map[string]interface{}); ok {
+				walk(prefix+k+".", sub)
+			} else {
+				flat[prefix+k] = v
+			}
+		}
+	}
+
+	walk("", values)
+
+	return flat
+}
+
+// Where a value comes from
+type ValueSource struct {
+	// The file that provides the value
+	File string `json:"file" yaml:"file"`
+
+	// If the file is vault encrypted
+	Vault bool `json:"vault" yaml:"vault"`
+
+	// The files whose values are overridden, earliest first
+	Overrides []string `json:"overrides,omitempty" yaml:"overrides,omitempty"`
+}
+
+// Value sources keyed by leaf value path
+type Provenance map[string]*ValueSource
+
+// If given value is from a vault encrypted file
+func (p Provenance) isVault(path string) bool {
+	src, ok := p[path]
+	return ok && src.Vault
+}
+
+// Record a value as from a vault encrypted file, e.g.
+// when it's interpolated with a value from one.
+func (p Provenance) markVault(path string) {
+	if p == nil {
+		return
+	}
+
+	src := &ValueSource{Vault: true}
+	if old, ok := p[path]; ok {
+		*src = *old
+		src.Vault = true
+	}
+
+	p[path] = src
+}
+
+// Record given source for all leaf values
+// and keep the sources being overridden.
+func (p Provenance) Record(src *ValueSource, values map[string]interface{}) {
+	for k := range FlattenValues(values) {
+		var overrides []string
+
+		// A leaf replacing a map or a map replacing a leaf
+		// overrides all the values under the same path.
+		for pk, ps := range p {
+			if pk == k || strings.HasPrefix(pk, k+".") || strings.HasPrefix(k, pk+".") {
+				overrides = append(overrides, ps.Overrides...)
+				overrides = append(overrides, ps.File)
+				delete(p, pk)
+			}
+		}
+
+		p[k] = &ValueSource{
+			File:      src.File,
+			Vault:     src.Vault,
+			Overrides: uniqueStrings(overrides),
+		}
+	}
+}
+
+// Merge sources of later values into the provenance
+func (p Provenance) Merge(later Provenance) {
+	for k, src := range later {
+		p.Record(src, map[string]interface{}{k: nil})
+		p[k].Overrides = uniqueStrings(append(p[k].Overrides, src.Overrides...))
+	}
+}
+
+// Remove duplicated strings keeping the first occurrence
+func uniqueStrings(list []string) []string {
+	var result []string
+	for _, s := range list {
+		if !utils.InSlice(result, s) {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
+
+// Value difference types
+const (
+	ValueDiffAdded   = "added"
+	ValueDiffRemoved = "removed"
+	ValueDiffChanged = "changed"
+)
+
+// Difference of a value between two value trees
+type ValueDiff struct {
+	Key  string      `json:"key" yaml:"key"`
+	Type string      `json:"type" yaml:"type"`
+	From interface{} `json:"from,omitempty" yaml:"from,omitempty"`
+	To   interface{} `json:"to,omitempty" yaml:"to,omitempty"`
+}
+
+// Compare two value trees by their leaf values.
+// The result is sorted by value key.
+func DiffValues(from, to map[string]interface{}) []*ValueDiff {
+	var diffs []*ValueDiff
+
+	ff := FlattenValues(from)
+	tf := FlattenValues(to)
+
+	for k, fv := range ff {
+		tv, ok := tf[k]
+		if !ok {
+			diffs = append(diffs, &ValueDiff{Key: k, Type: ValueDiffRemoved, From: fv})
+		} else if !reflect.DeepEqual(fv, tv) {
+			diffs = append(diffs, &ValueDiff{Key: k, Type: ValueDiffChanged, From: fv, To: tv})
+		}
+	}
+
+	for k, tv := range tf {
+		if _, ok := ff[k]; !ok {
+			diffs = append(diffs, &ValueDiff{Key: k, Type: ValueDiffAdded, To: tv})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Key < diffs[j].Key })
+
+	return diffs
+}
@@ -0,0 +1,105 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	// Prefix of environment variables overriding values
+	ENV_VAR_PREFIX = "CFCTL_VAR_"
+)
+
+// Parse a variable in the form of "key=value". It's only
+// split at the first "=" so the value can contain "=".
+func ParseVar(s string) (string, string, error) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || len(strings.TrimSpace(kv[0])) == 0 {
+		return "", "", errors.New(fmt.Sprintf("Invalid variable '%s', it must be in the form of 'key=value'", s))
+	}
+
+	return strings.TrimSpace(kv[0]), kv[1], nil
+}
+
+// Parse variables in the form of "key=value" into a value tree.
+// A key with dots, e.g. "db.port", sets the nested value.
+func ParseVars(vars []string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	for _, v := range vars {
+		key, value, err := ParseVar(v)
+		if err != nil {
+			return nil, err
+		}
+
+		values = MergeValues(values, nestValue(key, value))
+	}
+
+	return values, nil
+}
+
+// Parse comma delimited variables in the
+// form of "key1=value1,key2=value2".
+func ParseVarList(s string) (map[string]interface{}, error) {
+	if len(s) == 0 {
+		return make(map[string]interface{}), nil
+	}
+
+	return ParseVars(strings.Split(s, ","))
+}
+
+// Load variables from a file. The format is decided by the file
+// extension the same as value files. Others are treated as yaml.
+func LoadVarFile(path string) (map[string]interface{}, error) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decode := getValueDecoder(path)
+	if decode == nil {
+		decode = decodeYamlValues
+	}
+
+	values, err := decode(dat)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to parse variable file %s: %s", path, err))
+	}
+
+	return values, nil
+}
+
+// Get variables from environment variables with prefix
+// "CFCTL_VAR_". For example, "CFCTL_VAR_vpcCidr=10.0.0.0/16"
+// sets value "vpcCidr". The environ is in the form of os.Environ.
+func EnvVars(environ []string) map[string]interface{} {
+	var vars []string
+	for _, e := range environ {
+		if strings.HasPrefix(e, ENV_VAR_PREFIX) {
+			vars = append(vars, strings.TrimPrefix(e, ENV_VAR_PREFIX))
+		}
+	}
+
+	// Invalid ones are ignored as they are set outside cfctl
+	values := make(map[string]interface{})
+	for _, v := range vars {
+		if key, value, err := ParseVar(v); err == nil {
+			values = MergeValues(values, nestValue(key, value))
+		}
+	}
+
+	return values
+}
+
+// Create a value tree for given dot delimited key path
+func nestValue(key string, value interface{}) map[string]interface{} {
+	parts := strings.Split(key, ".")
+
+	values := map[string]interface{}{parts[len(parts)-1]: value}
+	for i := len(parts) - 2; i >= 0; i-- {
+		values = map[string]interface{}{parts[i]: values}
+	}
+
+	return values
+}
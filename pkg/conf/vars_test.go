@@ -0,0 +1,87 @@
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVar(t *testing.T) {
+	k, v, err := ParseVar("name=value")
+	assert.NoError(t, err)
+	assert.Equal(t, "name", k)
+	assert.Equal(t, "value", v)
+
+	// Only split at the first "="
+	k, v, err = ParseVar("query=a=b,c=d")
+	assert.NoError(t, err)
+	assert.Equal(t, "query", k)
+	assert.Equal(t, "a=b,c=d", v)
+
+	_, v, err = ParseVar("empty=")
+	assert.NoError(t, err)
+	assert.Equal(t, "", v)
+
+	_, _, err = ParseVar("novalue")
+	assert.Error(t, err)
+
+	_, _, err = ParseVar("=value")
+	assert.Error(t, err)
+}
+
+func TestParseVars(t *testing.T) {
+	values, err := ParseVars([]string{"a=1", "db.port=5432", "db.host=local"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"a":  "1",
+		"db": map[string]interface{}{"port": "5432", "host": "local"},
+	}, values)
+
+	_, err = ParseVarList("a=1,b")
+	assert.Error(t, err)
+
+	values, err = ParseVarList("")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(values))
+}
+
+func TestLoadVarFile(t *testing.T) {
+	for _, content := range []string{
+		`{"name": "test", "port": 8080, "db": {"host": "local"}}`,
+		"name: test\nport: 8080\ndb:\n  host: local",
+	} {
+		f, err := ioutil.TempFile("", "vars")
+		assert.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		assert.NoError(t, err)
+
+		values, err := LoadVarFile(f.Name())
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"name": "test",
+			"port": "8080",
+			"db":   map[string]interface{}{"host": "local"},
+		}, values)
+
+		os.Remove(f.Name())
+	}
+
+	_, err := LoadVarFile("/not/exist")
+	assert.Error(t, err)
+}
+
+func TestEnvVars(t *testing.T) {
+	values := EnvVars([]string{
+		"HOME=/root",
+		"CFCTL_VAR_vpcCidr=10.0.0.0/16",
+		"CFCTL_VAR_db.port=5432",
+		"CFCTL_VAR_invalid",
+	})
+
+	assert.Equal(t, map[string]interface{}{
+		"vpcCidr": "10.0.0.0/16",
+		"db":      map[string]interface{}{"port": "5432"},
+	}, values)
+}
@@ -0,0 +1,229 @@
+/*
+Package graph provides a simple directed dependency graph.
+Nodes keep the order they are added so sorting is deterministic.
+*/
+package graph
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/liangrog/cfctl/pkg/utils"
+)
+
+// Dependency graph
+type Graph struct {
+	// Node names in the order of being added
+	nodes []string
+
+	// Node position keyed by name
+	index map[string]int
+
+	// Dependencies keyed by node name
+	deps map[string][]string
+}
+
+// Graph constructor
+func New() *Graph {
+	return &Graph{
+		index: make(map[string]int),
+		deps:  make(map[string][]string),
+	}
+}
+
+// Add a node. Adding an existing node does nothing.
+func (g *Graph) AddNode(name string) {
+	if _, ok := g.index[name]; ok {
+		return
+	}
+
+	g.index[name] = len(g.nodes)
+	g.nodes = append(g.nodes, name)
+}
+
+// If the graph has given node
+func (g *Graph) HasNode(name string) bool {
+	_, ok := g.index[name]
+	return ok
+}
+
+// Return all nodes in the order of being added
+func (g *Graph) Nodes() []string {
+	return append([]string{}, g.nodes...)
+}
+
+// Add a dependency so node goes after dep.
+// Both nodes are added if they don't exist.
+func (g *Graph) AddDependency(node, dep string) {
+	g.AddNode(node)
+	g.AddNode(dep)
+
+	if !utils.InSlice(g.deps[node], dep) {
+		g.deps[node] = append(g.deps[node], dep)
+	}
+}
+
+// Return the nodes given node depends on
+func (g *Graph) Dependencies(node string) []string {
+	return append([]string{}, g.deps[node]...)
+}
+
+// Return the nodes depending on given node
+func (g *Graph) Dependents(node string) []string {
+	var result []string
+	for _, n := range g.nodes {
+		if utils.InSlice(g.deps[n], node) {
+			result = append(result, n)
+		}
+	}
+
+	return result
+}
+
+// Return all the nodes given nodes depend on directly or
+// indirectly. The result is in the order of being added.
+func (g *Graph) Ancestors(nodes ...string) []string {
+	return g.closure(nodes, g.Dependencies)
+}
+
+// Return all the nodes depending on given nodes directly
+// or indirectly. The result is in the order of being added.
+func (g *Graph) Descendants(nodes ...string) []string {
+	return g.closure(nodes, g.Dependents)
+}
+
+// Return the nodes reachable from given nodes by next,
+// excluding given nodes unless they are reachable.
+func (g *Graph) closure(nodes []string, next func(string) []string) []string {
+	found := make(map[string]bool)
+
+	queue := append([]string{}, nodes...)
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+
+		for _, m := range next(n) {
+			if !found[m] {
+				found[m] = true
+				queue = append(queue, m)
+			}
+		}
+	}
+
+	var result []string
+	for _, n := range g.nodes {
+		if found[n] {
+			result = append(result, n)
+		}
+	}
+
+	return result
+}
+
+// Return a cycle in the graph if there is any, e.g.
+// [a b a] means a depends on b and b depends on a.
+func (g *Graph) Cycle() []string {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	state := make(map[string]int)
+
+	var path []string
+	var visit func(n string) []string
+	visit = func(n string) []string {
+		switch state[n] {
+		case visited:
+			return nil
+		case visiting:
+			for i, p := range path {
+				if p == n {
+					return append(append([]string{}, path[i:]...), n)
+				}
+			}
+		}
+
+		state[n] = visiting
+		path = append(path, n)
+
+		for _, d := range g.deps[n] {
+			if cycle := visit(d); cycle != nil {
+				return cycle
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[n] = visited
+
+		return nil
+	}
+
+	for _, n := range g.nodes {
+		if cycle := visit(n); cycle != nil {
+			return cycle
+		}
+	}
+
+	return nil
+}
+
+// Sort nodes so every node goes after its dependencies. Among
+// the nodes ready at the same time, the earlier added goes first.
+// If the graph is cyclic, an error with the cycle path is returned.
+func (g *Graph) Sort() ([]string, error) {
+	// Kahn's algorithm with the ready nodes kept in a
+	// min-heap of their positions
+	pending := make([]int, len(g.nodes))
+	dependents := make([][]int, len(g.nodes))
+	ready := &indexHeap{}
+	for i, n := range g.nodes {
+		pending[i] = len(g.deps[n])
+		for _, d := range g.deps[n] {
+			dependents[g.index[d]] = append(dependents[g.index[d]], i)
+		}
+
+		if pending[i] == 0 {
+			heap.Push(ready, i)
+		}
+	}
+
+	sorted := make([]string, 0, len(g.nodes))
+	for ready.Len() > 0 {
+		i := heap.Pop(ready).(int)
+		sorted = append(sorted, g.nodes[i])
+
+		for _, d := range dependents[i] {
+			pending[d]--
+			if pending[d] == 0 {
+				heap.Push(ready, d)
+			}
+		}
+	}
+
+	if len(sorted) < len(g.nodes) {
+		return nil, errors.New(fmt.Sprintf("Circular dependency: %s", strings.Join(g.Cycle(), " -> ")))
+	}
+
+	return sorted, nil
+}
+
+// Min-heap of node positions for container/heap
+type indexHeap []int
+
+func (h indexHeap) Len() int           { return len(h) }
+func (h indexHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h indexHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *indexHeap) Push(x interface{}) {
+	*h = append(*h, x.(int))
+}
+
+func (h *indexHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
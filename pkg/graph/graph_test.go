@@ -0,0 +1,88 @@
+package graph
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraph(t *testing.T) {
+	g := New()
+	g.AddNode("vpc")
+	g.AddNode("lambda")
+	g.AddDependency("lambda", "iam")
+	g.AddDependency("lambda", "vpc")
+	g.AddDependency("lambda", "vpc")
+
+	assert.True(t, g.HasNode("iam"))
+	assert.False(t, g.HasNode("rds"))
+	assert.Equal(t, []string{"vpc", "lambda", "iam"}, g.Nodes())
+	assert.Equal(t, []string{"iam", "vpc"}, g.Dependencies("lambda"))
+	assert.Equal(t, []string{"lambda"}, g.Dependents("vpc"))
+	assert.Nil(t, g.Cycle())
+}
+
+func TestSort(t *testing.T) {
+	g := New()
+	for _, n := range []string{"a", "b", "c", "d", "e"} {
+		g.AddNode(n)
+	}
+
+	g.AddDependency("a", "d")
+	g.AddDependency("c", "e")
+	g.AddDependency("b", "c")
+
+	// Always the same order, earlier added goes first when possible
+	for i := 0; i < 10; i++ {
+		sorted, err := g.Sort()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"d", "a", "e", "c", "b"}, sorted)
+	}
+
+	// A long chain added in reverse order
+	g = New()
+	var expected []string
+	for i := 0; i < 5000; i++ {
+		g.AddNode(fmt.Sprintf("n%d", i))
+		if i > 0 {
+			g.AddDependency(fmt.Sprintf("n%d", i-1), fmt.Sprintf("n%d", i))
+		}
+		expected = append([]string{fmt.Sprintf("n%d", i)}, expected...)
+	}
+
+	sorted, err := g.Sort()
+	assert.NoError(t, err)
+	assert.Equal(t, expected, sorted)
+}
+
+func TestCycle(t *testing.T) {
+	g := New()
+	g.AddNode("x")
+	g.AddDependency("a", "b")
+	g.AddDependency("b", "c")
+	g.AddDependency("c", "a")
+
+	assert.Equal(t, []string{"a", "b", "c", "a"}, g.Cycle())
+
+	_, err := g.Sort()
+	assert.EqualError(t, err, "Circular dependency: a -> b -> c -> a")
+
+	g = New()
+	g.AddDependency("a", "a")
+	assert.Equal(t, []string{"a", "a"}, g.Cycle())
+}
+
+func TestClosure(t *testing.T) {
+	g := New()
+	g.AddDependency("lambda", "iam")
+	g.AddDependency("iam", "kms")
+	g.AddDependency("api", "lambda")
+	g.AddDependency("web", "vpc")
+
+	assert.Equal(t, []string{"iam", "kms"}, g.Ancestors("lambda"))
+	assert.Equal(t, []string{"lambda", "iam", "kms"}, g.Ancestors("api"))
+	assert.Equal(t, []string{"lambda", "api"}, g.Descendants("iam"))
+	assert.Equal(t, []string{"lambda", "iam", "api"}, g.Descendants("kms", "lambda"))
+	assert.Empty(t, g.Ancestors("kms"))
+}
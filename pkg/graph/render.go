@@ -0,0 +1,128 @@
+package graph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Node style for rendering
+type Style struct {
+	// Node label. Default to node name.
+	Label string
+
+	// Fill colour in hex, e.g. "#9be9a8"
+	Colour string
+
+	// Border colour in hex
+	Border string
+
+	// Draw dashed border
+	Dashed bool
+}
+
+// Return node label
+func (g *Graph) label(n string, styles map[string]*Style) string {
+	if s, ok := styles[n]; ok && len(s.Label) > 0 {
+		return s.Label
+	}
+
+	return n
+}
+
+// Render graph in Graphviz DOT language. Edges
+// point from a node to the nodes depending on it.
+func (g *Graph) Dot(name string, styles map[string]*Style) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "digraph %s {\n", strconv.Quote(name))
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box];\n")
+
+	for _, n := range g.nodes {
+		attrs := []string{"label=" + strconv.Quote(g.label(n, styles))}
+
+		if s, ok := styles[n]; ok {
+			var style []string
+			if len(s.Colour) > 0 {
+				style = append(style, "filled")
+				attrs = append(attrs, "fillcolor="+strconv.Quote(s.Colour))
+			}
+
+			if s.Dashed {
+				style = append(style, "dashed")
+			}
+
+			if len(style) > 0 {
+				attrs = append(attrs, "style="+strconv.Quote(strings.Join(style, ",")))
+			}
+
+			if len(s.Border) > 0 {
+				attrs = append(attrs, "color="+strconv.Quote(s.Border))
+			}
+		}
+
+		fmt.Fprintf(&b, "  %s [%s];\n", strconv.Quote(n), strings.Join(attrs, ", "))
+	}
+
+	for _, n := range g.nodes {
+		for _, d := range g.deps[n] {
+			fmt.Fprintf(&b, "  %s -> %s;\n", strconv.Quote(d), strconv.Quote(n))
+		}
+	}
+
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+// Render graph as Mermaid flowchart. Edges point
+// from a node to the nodes depending on it.
+func (g *Graph) Mermaid(styles map[string]*Style) string {
+	var b strings.Builder
+
+	b.WriteString("flowchart LR\n")
+
+	// Node names may contain characters not
+	// allowed in Mermaid ids, so use index.
+	id := func(n string) string {
+		return fmt.Sprintf("n%d", g.index[n])
+	}
+
+	for _, n := range g.nodes {
+		label := strings.Replace(g.label(n, styles), `"`, "#quot;", -1)
+		fmt.Fprintf(&b, "  %s[\"%s\"]\n", id(n), label)
+	}
+
+	for _, n := range g.nodes {
+		for _, d := range g.deps[n] {
+			fmt.Fprintf(&b, "  %s --> %s\n", id(d), id(n))
+		}
+	}
+
+	for _, n := range g.nodes {
+		s, ok := styles[n]
+		if !ok {
+			continue
+		}
+
+		var attrs []string
+		if len(s.Colour) > 0 {
+			attrs = append(attrs, "fill:"+s.Colour)
+		}
+
+		if len(s.Border) > 0 {
+			attrs = append(attrs, "stroke:"+s.Border)
+		}
+
+		if s.Dashed {
+			attrs = append(attrs, "stroke-dasharray: 5 5")
+		}
+
+		if len(attrs) > 0 {
+			fmt.Fprintf(&b, "  style %s %s\n", id(n), strings.Join(attrs, ","))
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,52 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDot(t *testing.T) {
+	g := New()
+	g.AddNode("vpc")
+	g.AddDependency("app", "vpc")
+	g.AddDependency("app", "external")
+
+	styles := map[string]*Style{
+		"vpc":      {Colour: "#9be9a8"},
+		"external": {Label: "external (undefined)", Border: "#ff0000", Dashed: true},
+	}
+
+	assert.Equal(t, `digraph "stacks" {
+  rankdir=LR;
+  node [shape=box];
+  "vpc" [label="vpc", fillcolor="#9be9a8", style="filled"];
+  "app" [label="app"];
+  "external" [label="external (undefined)", style="dashed", color="#ff0000"];
+  "vpc" -> "app";
+  "external" -> "app";
+}
+`, g.Dot("stacks", styles))
+}
+
+func TestMermaid(t *testing.T) {
+	g := New()
+	g.AddNode("vpc")
+	g.AddDependency("app", "vpc")
+	g.AddDependency("app", "external")
+
+	styles := map[string]*Style{
+		"vpc":      {Colour: "#9be9a8"},
+		"external": {Label: `"external"`, Border: "#ff0000", Dashed: true},
+	}
+
+	assert.Equal(t, `flowchart LR
+  n0["vpc"]
+  n1["app"]
+  n2["#quot;external#quot;"]
+  n0 --> n1
+  n2 --> n1
+  style n0 fill:#9be9a8
+  style n2 stroke:#ff0000,stroke-dasharray: 5 5
+`, g.Mermaid(styles))
+}
@@ -0,0 +1,646 @@
+package cfn
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/liangrog/cfctl/pkg/graph"
+	"github.com/liangrog/cfctl/pkg/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// Finding severities
+const (
+	SEVERITY_ERROR   = "error"
+	SEVERITY_WARNING = "warning"
+)
+
+// Lint rules
+const (
+	RULE_PARSE                = "parse"
+	RULE_SIZE_LIMIT           = "size-limit"
+	RULE_DUPLICATE_ID         = "duplicate-id"
+	RULE_UNDEFINED_REF        = "undefined-ref"
+	RULE_UNDEFINED_GETATT     = "undefined-getatt"
+	RULE_UNDEFINED_CONDITION  = "undefined-condition"
+	RULE_UNDEFINED_DEPENDS_ON = "undefined-depends-on"
+	RULE_UNUSED_PARAMETER     = "unused-parameter"
+	RULE_UNUSED_CONDITION     = "unused-condition"
+	RULE_CIRCULAR_DEPENDENCY  = "circular-dependency"
+	RULE_EXPORT_NAME          = "export-name"
+)
+
+// Template sections not parsed otherwise
+const (
+	SECTION_MAPPINGS  = "Mappings"
+	SECTION_RULES     = "Rules"
+	SECTION_TRANSFORM = "Transform"
+	SECTION_GLOBALS   = "Globals"
+)
+
+// CloudFormation template limits
+const (
+	maxBodySize         = 51200
+	maxS3BodySize       = 1000000
+	maxResources        = 500
+	maxParameters       = 200
+	maxOutputs          = 200
+	maxMappings         = 200
+	maxExportNameLength = 255
+)
+
+// Pseudo parameters can be referenced without being defined
+var pseudoParams = []string{
+	"AWS::AccountId",
+	"AWS::NotificationARNs",
+	"AWS::NoValue",
+	"AWS::Partition",
+	"AWS::Region",
+	"AWS::StackId",
+	"AWS::StackName",
+	"AWS::URLSuffix",
+}
+
+var (
+	// Line number in parse errors
+	errLineRegexp = regexp.MustCompile(`line (\d+)`)
+
+	// Variables in Fn::Sub string. "${!Literal}" isn't a variable.
+	subVarRegexp = regexp.MustCompile(`\$\{([^!}][^}]*)\}`)
+
+	// Allowed characters of export names
+	exportNameRegexp = regexp.MustCompile(`^[A-Za-z0-9:-]+$`)
+)
+
+// A problem found in a template
+type Finding struct {
+	// Location in "file:line" format
+	Location string `json:"location" yaml:"location"`
+	Severity string `json:"severity" yaml:"severity"`
+	Rule     string `json:"rule" yaml:"rule"`
+	Message  string `json:"message" yaml:"message"`
+
+	line int
+}
+
+func (f *Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s (%s)", f.Location, f.Severity, f.Message, f.Rule)
+}
+
+// If the finding is an error
+func (f *Finding) IsError() bool {
+	return f.Severity == SEVERITY_ERROR
+}
+
+// Template linter
+type linter struct {
+	file     string
+	root     *yaml.Node
+	findings []*Finding
+
+	// Key nodes of logical IDs in the order of the template
+	params     []*yaml.Node
+	resources  []*yaml.Node
+	conditions []*yaml.Node
+
+	// Referenced parameters and conditions
+	usedParams     map[string]bool
+	usedConditions map[string]bool
+
+	// Resource dependencies by DependsOn, Ref and GetAtt
+	deps *graph.Graph
+
+	// The template has transforms, e.g. SAM, which
+	// add resources not defined in the template
+	transform bool
+}
+
+// Check a template locally without calling AWS. The file
+// name is only used for locations of the findings, which
+// are sorted by line. The template is expected to be
+// uploaded to S3, e.g. a nested template of "tpl".
+func Lint(file string, dat []byte) []*Finding {
+	return lint(file, dat, false)
+}
+
+// Check a template as Lint does. The template is sent inline
+// as the template body, as cfctl does for stack templates, so
+// it's an error if it's too big for that.
+func LintInline(file string, dat []byte) []*Finding {
+	return lint(file, dat, true)
+}
+
+// Check a template
+func lint(file string, dat []byte, inline bool) []*Finding {
+	l := &linter{
+		file:           file,
+		usedParams:     make(map[string]bool),
+		usedConditions: make(map[string]bool),
+		deps:           graph.New(),
+	}
+
+	switch {
+	case len(dat) > maxS3BodySize:
+		l.add(nil, SEVERITY_ERROR, RULE_SIZE_LIMIT, fmt.Sprintf("Template is %d bytes, more than the maximum %d bytes", len(dat), maxS3BodySize))
+	case len(dat) > maxBodySize && inline:
+		l.add(nil, SEVERITY_ERROR, RULE_SIZE_LIMIT, fmt.Sprintf("Template is %d bytes, more than the maximum %d bytes of a template body", len(dat), maxBodySize))
+	case len(dat) > maxBodySize:
+		l.add(nil, SEVERITY_WARNING, RULE_SIZE_LIMIT, fmt.Sprintf("Template is %d bytes, more than %d bytes it can only be deployed from S3", len(dat), maxBodySize))
+	}
+
+	t, err := Parse(dat)
+	if err != nil {
+		line := 0
+		if m := errLineRegexp.FindStringSubmatch(err.Error()); m != nil {
+			line, _ = strconv.Atoi(m[1])
+		}
+
+		l.addLine(line, SEVERITY_ERROR, RULE_PARSE, err.Error())
+
+		return l.result()
+	}
+
+	if t.root == nil {
+		l.addLine(0, SEVERITY_ERROR, RULE_PARSE, "Template is empty")
+		return l.result()
+	}
+
+	l.root = t.root
+	l.transform = mapValue(l.root, SECTION_TRANSFORM) != nil
+	if !l.collect() {
+		return l.result()
+	}
+
+	l.checkLimits()
+	l.checkReferences()
+	l.checkUnused()
+	l.checkCycle()
+	l.checkExports()
+
+	return l.result()
+}
+
+// Add a finding at the line of a node
+func (l *linter) add(n *yaml.Node, severity, rule, msg string) {
+	line := 0
+	if n != nil {
+		line = n.Line
+	}
+
+	l.addLine(line, severity, rule, msg)
+}
+
+// Add a finding at a line. Line 0 means the whole file.
+func (l *linter) addLine(line int, severity, rule, msg string) {
+	loc := l.file
+	if line > 0 {
+		loc = fmt.Sprintf("%s:%d", l.file, line)
+	}
+
+	l.findings = append(l.findings, &Finding{
+		Location: loc,
+		Severity: severity,
+		Rule:     rule,
+		Message:  msg,
+		line:     line,
+	})
+}
+
+// Return findings sorted by line
+func (l *linter) result() []*Finding {
+	sort.SliceStable(l.findings, func(i, j int) bool {
+		return l.findings[i].line < l.findings[j].line
+	})
+
+	return l.findings
+}
+
+// Collect logical IDs and check their uniqueness. Return
+// false if the template structure is too broken to go on.
+func (l *linter) collect() bool {
+	if l.checkDuplicateKeys(l.root, "Section") {
+		return false
+	}
+
+	ok := true
+	for _, s := range []string{SECTION_PARAMETERS, SECTION_MAPPINGS, SECTION_CONDITIONS, SECTION_RESOURCES, SECTION_OUTPUTS, SECTION_RULES} {
+		n := mapValue(l.root, s)
+		if n == nil {
+			continue
+		}
+
+		if n.Kind != yaml.MappingNode {
+			l.add(n, SEVERITY_ERROR, RULE_PARSE, fmt.Sprintf("%s must be a map", s))
+			ok = false
+			continue
+		}
+
+		l.checkDuplicateKeys(n, "Logical ID")
+	}
+
+	if !ok {
+		return false
+	}
+
+	if mapValue(l.root, SECTION_RESOURCES) == nil {
+		l.addLine(1, SEVERITY_ERROR, RULE_PARSE, "Resources section is required")
+	}
+
+	l.params = uniqueKeys(mapValue(l.root, SECTION_PARAMETERS))
+	l.conditions = uniqueKeys(mapValue(l.root, SECTION_CONDITIONS))
+	l.resources = uniqueKeys(mapValue(l.root, SECTION_RESOURCES))
+
+	// Parameters and resources share the names of Ref
+	for _, r := range l.resources {
+		if p := findKey(l.params, r.Value); p != nil {
+			l.add(r, SEVERITY_ERROR, RULE_DUPLICATE_ID, fmt.Sprintf("Logical ID %s is used by both a parameter at line %d and a resource", r.Value, p.Line))
+		}
+
+		l.deps.AddNode(r.Value)
+	}
+
+	return true
+}
+
+// Report keys defined more than once in a map node.
+// Return true if there is any.
+func (l *linter) checkDuplicateKeys(n *yaml.Node, what string) bool {
+	seen := make(map[string]*yaml.Node)
+	found := false
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k := n.Content[i]
+		if prev, ok := seen[k.Value]; ok {
+			l.add(k, SEVERITY_ERROR, RULE_DUPLICATE_ID, fmt.Sprintf("%s %s is defined more than once, first at line %d", what, k.Value, prev.Line))
+			found = true
+			continue
+		}
+
+		seen[k.Value] = k
+	}
+
+	return found
+}
+
+// Check the number of parameters, resources, outputs and mappings
+func (l *linter) checkLimits() {
+	limits := []struct {
+		section string
+		max     int
+	}{
+		{SECTION_PARAMETERS, maxParameters},
+		{SECTION_MAPPINGS, maxMappings},
+		{SECTION_RESOURCES, maxResources},
+		{SECTION_OUTPUTS, maxOutputs},
+	}
+
+	for _, lim := range limits {
+		n := mapValue(l.root, lim.section)
+		if n == nil {
+			continue
+		}
+
+		if count := len(n.Content) / 2; count > lim.max {
+			l.add(mapKey(l.root, lim.section), SEVERITY_ERROR, RULE_SIZE_LIMIT, fmt.Sprintf("%s has %d entries, more than the maximum %d", lim.section, count, lim.max))
+		}
+	}
+}
+
+// Severity of references to undefined targets. Transforms
+// may add the targets, e.g. SAM's ServerlessRestApi, so
+// they are only warnings then.
+func (l *linter) undefinedSeverity() string {
+	if l.transform {
+		return SEVERITY_WARNING
+	}
+
+	return SEVERITY_ERROR
+}
+
+// Check references in conditions, resources, outputs and rules,
+// and SAM globals
+func (l *linter) checkReferences() {
+	for _, s := range []string{SECTION_CONDITIONS, SECTION_RULES, SECTION_GLOBALS} {
+		if n := mapValue(l.root, s); n != nil {
+			for i := 1; i < len(n.Content); i += 2 {
+				l.walk(n.Content[i], "")
+			}
+		}
+	}
+
+	for _, s := range []string{SECTION_RESOURCES, SECTION_OUTPUTS} {
+		n := mapValue(l.root, s)
+		if n == nil {
+			continue
+		}
+
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			owner := ""
+			if s == SECTION_RESOURCES {
+				owner = n.Content[i].Value
+			}
+
+			l.walkEntry(n.Content[i+1], owner)
+		}
+	}
+}
+
+// Walk a resource or output. Its Condition and DependsOn
+// are attributes rather than intrinsic functions.
+func (l *linter) walkEntry(n *yaml.Node, owner string) {
+	if n.Kind != yaml.MappingNode {
+		l.walk(n, owner)
+		return
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		switch {
+		case k.Value == "Condition" && v.Kind == yaml.ScalarNode:
+			l.conditionRef(v)
+		case k.Value == "DependsOn" && len(owner) > 0:
+			deps := []*yaml.Node{v}
+			if v.Kind == yaml.SequenceNode {
+				deps = v.Content
+			}
+
+			for _, d := range deps {
+				if findKey(l.resources, d.Value) == nil {
+					l.add(d, l.undefinedSeverity(), RULE_UNDEFINED_DEPENDS_ON, fmt.Sprintf("Resource %s depends on undefined resource %s", owner, d.Value))
+					continue
+				}
+
+				l.deps.AddDependency(owner, d.Value)
+			}
+		default:
+			l.walk(v, owner)
+		}
+	}
+}
+
+// Walk a node for intrinsic functions. The owner is the
+// resource the node belongs to, empty if none.
+func (l *linter) walk(n *yaml.Node, owner string) {
+	fn, arg := intrinsic(n)
+	switch fn {
+	case "Ref":
+		if arg.Kind == yaml.ScalarNode {
+			l.ref(arg, arg.Value, owner)
+			return
+		}
+	case "Fn::GetAtt":
+		switch {
+		case arg.Kind == yaml.ScalarNode:
+			l.getAtt(arg, strings.SplitN(arg.Value, ".", 2)[0], owner)
+			return
+		case arg.Kind == yaml.SequenceNode && len(arg.Content) > 0 && arg.Content[0].Kind == yaml.ScalarNode:
+			l.getAtt(arg.Content[0], arg.Content[0].Value, owner)
+		}
+	case "Fn::Sub":
+		l.sub(arg, owner)
+		return
+	case "Condition":
+		if arg.Kind == yaml.ScalarNode {
+			l.conditionRef(arg)
+			return
+		}
+	case "Fn::If":
+		if arg.Kind == yaml.SequenceNode && len(arg.Content) > 0 && arg.Content[0].Kind == yaml.ScalarNode {
+			l.conditionRef(arg.Content[0])
+		}
+	}
+
+	if arg != nil && arg != n {
+		l.walk(arg, owner)
+		return
+	}
+
+	for _, c := range n.Content {
+		l.walk(c, owner)
+	}
+}
+
+// Check a Ref target
+func (l *linter) ref(n *yaml.Node, name, owner string) {
+	switch {
+	case utils.InSlice(pseudoParams, name):
+	case findKey(l.params, name) != nil:
+		l.usedParams[name] = true
+	case findKey(l.resources, name) != nil:
+		if len(owner) > 0 {
+			l.deps.AddDependency(owner, name)
+		}
+	default:
+		l.add(n, l.undefinedSeverity(), RULE_UNDEFINED_REF, fmt.Sprintf("Ref to undefined parameter or resource %s", name))
+	}
+}
+
+// Check a GetAtt target
+func (l *linter) getAtt(n *yaml.Node, name, owner string) {
+	if findKey(l.resources, name) == nil {
+		l.add(n, l.undefinedSeverity(), RULE_UNDEFINED_GETATT, fmt.Sprintf("GetAtt of undefined resource %s", name))
+		return
+	}
+
+	if len(owner) > 0 {
+		l.deps.AddDependency(owner, name)
+	}
+}
+
+// Check a condition reference
+func (l *linter) conditionRef(n *yaml.Node) {
+	if findKey(l.conditions, n.Value) == nil {
+		l.add(n, SEVERITY_ERROR, RULE_UNDEFINED_CONDITION, fmt.Sprintf("Condition %s is not defined", n.Value))
+		return
+	}
+
+	l.usedConditions[n.Value] = true
+}
+
+// Check variables of Fn::Sub, either a string or a list
+// of the string and a map of variables.
+func (l *linter) sub(arg *yaml.Node, owner string) {
+	str := arg
+	vars := map[string]bool{}
+
+	if arg.Kind == yaml.SequenceNode {
+		if len(arg.Content) == 0 {
+			return
+		}
+
+		str = arg.Content[0]
+		if len(arg.Content) > 1 && arg.Content[1].Kind == yaml.MappingNode {
+			m := arg.Content[1]
+			for i := 0; i+1 < len(m.Content); i += 2 {
+				vars[m.Content[i].Value] = true
+				l.walk(m.Content[i+1], owner)
+			}
+		}
+	}
+
+	if str.Kind != yaml.ScalarNode {
+		l.walk(str, owner)
+		return
+	}
+
+	for _, m := range subVarRegexp.FindAllStringSubmatch(str.Value, -1) {
+		name := strings.TrimSpace(m[1])
+		if vars[name] {
+			continue
+		}
+
+		if parts := strings.SplitN(name, ".", 2); len(parts) == 2 {
+			l.getAtt(str, parts[0], owner)
+			continue
+		}
+
+		l.ref(str, name, owner)
+	}
+}
+
+// Report parameters and conditions never referenced
+func (l *linter) checkUnused() {
+	for _, p := range l.params {
+		if !l.usedParams[p.Value] {
+			l.add(p, SEVERITY_WARNING, RULE_UNUSED_PARAMETER, fmt.Sprintf("Parameter %s is not used", p.Value))
+		}
+	}
+
+	for _, c := range l.conditions {
+		if !l.usedConditions[c.Value] {
+			l.add(c, SEVERITY_WARNING, RULE_UNUSED_CONDITION, fmt.Sprintf("Condition %s is not used", c.Value))
+		}
+	}
+}
+
+// Check circular dependency between resources
+func (l *linter) checkCycle() {
+	cycle := l.deps.Cycle()
+	if cycle == nil {
+		return
+	}
+
+	l.add(findKey(l.resources, cycle[0]), SEVERITY_ERROR, RULE_CIRCULAR_DEPENDENCY, fmt.Sprintf("Circular dependency: %s", strings.Join(cycle, " -> ")))
+}
+
+// Check export names of outputs. Names built by Fn::Sub
+// are checked without the variables.
+func (l *linter) checkExports() {
+	outputs := mapValue(l.root, SECTION_OUTPUTS)
+	if outputs == nil {
+		return
+	}
+
+	seen := make(map[string]*yaml.Node)
+	for i := 0; i+1 < len(outputs.Content); i += 2 {
+		output := outputs.Content[i].Value
+
+		export := mapValue(outputs.Content[i+1], "Export")
+		if export == nil {
+			continue
+		}
+
+		name := mapValue(export, "Name")
+		if name == nil {
+			l.add(export, SEVERITY_ERROR, RULE_EXPORT_NAME, fmt.Sprintf("Output %s export has no name", output))
+			continue
+		}
+
+		fn, arg := intrinsic(name)
+		if fn == "Fn::Sub" && arg.Kind == yaml.SequenceNode && len(arg.Content) > 0 {
+			arg = arg.Content[0]
+		}
+
+		switch {
+		case len(fn) == 0 && name.Kind == yaml.ScalarNode:
+			if prev, ok := seen[name.Value]; ok {
+				l.add(name, SEVERITY_ERROR, RULE_EXPORT_NAME, fmt.Sprintf("Export name %s is used more than once, first at line %d", name.Value, prev.Line))
+			}
+
+			seen[name.Value] = name
+			l.checkExportName(name, output, name.Value, name.Value)
+		case fn == "Fn::Sub" && arg.Kind == yaml.ScalarNode:
+			literal := subVarRegexp.ReplaceAllString(arg.Value, "")
+			l.checkExportName(name, output, arg.Value, literal)
+		}
+	}
+}
+
+// Check the literal part of an export name
+func (l *linter) checkExportName(n *yaml.Node, output, name, literal string) {
+	switch {
+	case len(name) == 0:
+		l.add(n, SEVERITY_ERROR, RULE_EXPORT_NAME, fmt.Sprintf("Output %s export name is empty", output))
+	case len(literal) > maxExportNameLength:
+		l.add(n, SEVERITY_ERROR, RULE_EXPORT_NAME, fmt.Sprintf("Output %s export name is longer than %d characters", output, maxExportNameLength))
+	case len(literal) > 0 && !exportNameRegexp.MatchString(literal):
+		l.add(n, SEVERITY_ERROR, RULE_EXPORT_NAME, fmt.Sprintf("Output %s export name '%s' can only contain alphanumeric characters, colons and hyphens", output, name))
+	}
+}
+
+// Return the name and the argument of an intrinsic function
+// node in either short form, e.g. "!Ref Name", or long form,
+// e.g. {"Ref": "Name"}. The name is empty if it isn't one.
+func intrinsic(n *yaml.Node) (string, *yaml.Node) {
+	if strings.HasPrefix(n.Tag, "!") && !strings.HasPrefix(n.Tag, "!!") {
+		name := strings.TrimPrefix(n.Tag, "!")
+		if name != "Ref" && name != "Condition" {
+			name = "Fn::" + name
+		}
+
+		return name, n
+	}
+
+	if n.Kind == yaml.MappingNode && len(n.Content) == 2 {
+		k := n.Content[0].Value
+		if k == "Ref" || strings.HasPrefix(k, "Fn::") || (k == "Condition" && n.Content[1].Kind == yaml.ScalarNode) {
+			return k, n.Content[1]
+		}
+	}
+
+	return "", nil
+}
+
+// Return the first occurrence of each key in a map node
+func uniqueKeys(n *yaml.Node) []*yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	var keys []*yaml.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if findKey(keys, n.Content[i].Value) == nil {
+			keys = append(keys, n.Content[i])
+		}
+	}
+
+	return keys
+}
+
+// Return the key node of given name
+func findKey(keys []*yaml.Node, name string) *yaml.Node {
+	for _, k := range keys {
+		if k.Value == name {
+			return k
+		}
+	}
+
+	return nil
+}
+
+// Return the key node of a key in a map node
+func mapKey(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package cfn
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Return findings in "line: severity: rule" format
+func lintSummary(findings []*Finding) []string {
+	var result []string
+	for _, f := range findings {
+		result = append(result, fmt.Sprintf("%s: %s: %s", strings.TrimPrefix(f.Location, "t.yaml:"), f.Severity, f.Rule))
+	}
+
+	return result
+}
+
+func TestLint(t *testing.T) {
+	findings := Lint("t.yaml", []byte(testTemplate))
+	assert.Equal(t, 7, len(findings))
+	assert.Equal(t, "t.yaml:4: warning: Parameter Env is not used (unused-parameter)", findings[0].String())
+	assert.False(t, findings[0].IsError())
+
+	tpl := `
+Parameters:
+  Env:
+    Type: String
+  Unused:
+    Type: String
+Conditions:
+  IsProd: !Equals [!Ref Env, prod]
+  IsDev: {"Fn::Equals": [{"Ref": "Env"}, dev]}
+  Never: !Not [!Condition IsMissing]
+Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+    Condition: IsProd
+    DependsOn: [Queue, Missing]
+    Properties:
+      BucketName: !Sub "${Env}-${AWS::Region}-${Topic}-${!Literal}"
+      Tags:
+        - Key: arn
+          Value: !GetAtt Queue.Arn
+  Queue:
+    Type: AWS::SQS::Queue
+    Properties:
+      QueueName: !If [IsDev, !GetAtt Bucket.Arn, !Ref "AWS::NoValue"]
+      Other: !Sub
+        - "${Var}-${Lost.Arn}"
+        - Var: !Ref Nothing
+  Queue:
+    Type: AWS::SQS::Queue
+Outputs:
+  Name:
+    Value: !Ref Bucket
+    Export:
+      Name: !Sub "${AWS::StackName}-bucket_name"
+  Arn:
+    Value: !GetAtt Queue.Arn
+    Export:
+      Name: shared-arn
+  Other:
+    Value: !Ref Queue
+    Export:
+      Name: shared-arn
+`
+
+	assert.Equal(t, []string{
+		"5: warning: unused-parameter",
+		"10: error: undefined-condition",
+		"10: warning: unused-condition",
+		"12: error: circular-dependency",
+		"15: error: undefined-depends-on",
+		"17: error: undefined-ref",
+		"26: error: undefined-getatt",
+		"27: error: undefined-ref",
+		"28: error: duplicate-id",
+		"34: error: export-name",
+		"42: error: export-name",
+	}, lintSummary(Lint("t.yaml", []byte(tpl))))
+
+	// JSON
+	tpl = `{
+  "Parameters": {"Env": {"Type": "String"}},
+  "Resources": {
+    "Env": {"Type": "AWS::SNS::Topic"},
+    "Bucket": {"Type": "AWS::S3::Bucket", "Properties": {"BucketName": {"Fn::GetAtt": ["Topic", "Name"]}}}
+  }
+}`
+
+	assert.Equal(t, []string{
+		"2: warning: unused-parameter",
+		"4: error: duplicate-id",
+		"5: error: undefined-getatt",
+	}, lintSummary(Lint("t.yaml", []byte(tpl))))
+
+	// Broken templates
+	assert.Equal(t, []string{"2: error: parse"}, lintSummary(Lint("t.yaml", []byte("Resources:\n  A: b\n c: d"))))
+	assert.Equal(t, []string{"1: error: parse"}, lintSummary(Lint("t.yaml", []byte("Parameters: {}"))))
+	assert.Equal(t, []string{"t.yaml: error: parse"}, lintSummary(Lint("t.yaml", []byte(""))))
+
+	// Resources added by transforms can't be checked
+	tpl = `
+Transform: AWS::Serverless-2016-10-31
+Parameters:
+  Stage:
+    Type: String
+Globals:
+  Function:
+    Environment:
+      Variables:
+        STAGE: !Ref Stage
+Resources:
+  Function:
+    Type: AWS::Serverless::Function
+    Properties:
+      Events:
+        Api:
+          Type: Api
+Outputs:
+  Url:
+    Value: !Sub "https://${ServerlessRestApi}.execute-api.${AWS::Region}.amazonaws.com/"
+  Role:
+    Value: !GetAtt FunctionRole.Arn
+`
+
+	assert.Equal(t, []string{
+		"20: warning: undefined-ref",
+		"22: warning: undefined-getatt",
+	}, lintSummary(Lint("t.yaml", []byte(tpl))))
+}
+
+func TestLintLimits(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("Resources:\n")
+	for i := 0; i <= maxResources; i++ {
+		fmt.Fprintf(&b, "  Topic%d:\n    Type: AWS::SNS::Topic\n    Properties:\n      DisplayName: %s\n", i, strings.Repeat("x", 100))
+	}
+
+	assert.Equal(t, []string{
+		"t.yaml: warning: size-limit",
+		"1: error: size-limit",
+	}, lintSummary(Lint("t.yaml", []byte(b.String()))))
+
+	// Template bodies sent inline can't be uploaded to S3 instead
+	assert.Equal(t, []string{
+		"t.yaml: error: size-limit",
+		"1: error: size-limit",
+	}, lintSummary(LintInline("t.yaml", []byte(b.String()))))
+}
@@ -0,0 +1,141 @@
+package cfn
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"gopkg.in/yaml.v3"
+)
+
+// Normalise a template so templates differing only in format can
+// be compared, e.g. JSON and YAML, short and long form intrinsic
+// functions, key order, comments and quoting. Maps are decoded as
+// map[string]interface{} and scalars as their string values.
+func Normalize(dat []byte) (interface{}, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(dat, &doc); err != nil {
+		return nil, err
+	}
+
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	return normalizeNode(doc.Content[0])
+}
+
+// Normalise a node
+func normalizeNode(n *yaml.Node) (interface{}, error) {
+	if fn, arg := intrinsic(n); len(fn) > 0 && arg == n {
+		// Short form, normalise the node without its tag
+		plain := *n
+		plain.Tag = ""
+
+		v, err := normalizeNode(&plain)
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]interface{}{fn: normalizeGetAtt(fn, v)}, nil
+	}
+
+	switch n.Kind {
+	case yaml.MappingNode:
+		m := make(map[string]interface{})
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			v, err := normalizeNode(n.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+
+			k := n.Content[i].Value
+			m[k] = normalizeGetAtt(k, v)
+		}
+
+		return m, nil
+	case yaml.SequenceNode:
+		l := make([]interface{}, 0, len(n.Content))
+		for _, c := range n.Content {
+			v, err := normalizeNode(c)
+			if err != nil {
+				return nil, err
+			}
+
+			l = append(l, v)
+		}
+
+		return l, nil
+	case yaml.AliasNode:
+		return normalizeNode(n.Alias)
+	case yaml.ScalarNode:
+		if n.Tag == "!!null" {
+			return nil, nil
+		}
+
+		return n.Value, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("line %d: Unsupported node", n.Line))
+}
+
+// GetAtt can be either "Resource.Attribute" or a list,
+// normalise it to the list.
+func normalizeGetAtt(fn string, v interface{}) interface{} {
+	if s, ok := v.(string); ok && fn == "Fn::GetAtt" {
+		var l []interface{}
+		for _, p := range strings.SplitN(s, ".", 2) {
+			l = append(l, p)
+		}
+
+		return l
+	}
+
+	return v
+}
+
+// Return the unified diff of two templates after normalising
+// them, empty if they are the same.
+func Diff(from, to []byte, fromName, toName string) (string, error) {
+	a, err := normalizedYaml(from)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := normalizedYaml(to)
+	if err != nil {
+		return "", err
+	}
+
+	if a == b {
+		return "", nil
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(strings.TrimSuffix(a, "\n")),
+		B:        difflib.SplitLines(strings.TrimSuffix(b, "\n")),
+		FromFile: fromName,
+		ToFile:   toName,
+		Context:  3,
+	})
+}
+
+// Return normalised template in YAML with sorted keys
+func normalizedYaml(dat []byte) (string, error) {
+	v, err := Normalize(dat)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
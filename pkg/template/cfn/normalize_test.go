@@ -0,0 +1,68 @@
+package cfn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	yamlTpl := `
+# Comment
+Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+    Properties:
+      BucketName: !Sub "${AWS::StackName}-bucket"
+      Size: 10
+      Arn: !GetAtt Queue.Arn
+      Name: !Ref Name
+      Empty: ~
+`
+
+	jsonTpl := `{
+  "Resources": {
+    "Bucket": {
+      "Properties": {
+        "Empty": null,
+        "Name": {"Ref": "Name"},
+        "Arn": {"Fn::GetAtt": ["Queue", "Arn"]},
+        "Size": "10",
+        "BucketName": {"Fn::Sub": "${AWS::StackName}-bucket"}
+      },
+      "Type": "AWS::S3::Bucket"
+    }
+  }
+}`
+
+	y, err := Normalize([]byte(yamlTpl))
+	assert.NoError(t, err)
+
+	j, err := Normalize([]byte(jsonTpl))
+	assert.NoError(t, err)
+	assert.Equal(t, y, j)
+
+	j, err = Normalize([]byte(`{"Resources": {"Bucket": {"Type": "AWS::S3::Bucket"}}}`))
+	assert.NoError(t, err)
+	assert.NotEqual(t, y, j)
+
+	_, err = Normalize([]byte("Resources: ["))
+	assert.Error(t, err)
+}
+
+func TestDiff(t *testing.T) {
+	d, err := Diff([]byte(`{"Resources": {"A": {"Type": "AWS::SNS::Topic"}}}`), []byte("Resources:\n  A:\n    Type: AWS::SNS::Topic\n"), "deployed", "local")
+	assert.NoError(t, err)
+	assert.Empty(t, d)
+
+	d, err = Diff([]byte(`{"Resources": {"A": {"Type": "AWS::SNS::Topic"}}}`), []byte("Resources:\n  A:\n    Type: AWS::SQS::Queue\n"), "deployed", "local")
+	assert.NoError(t, err)
+	assert.Equal(t, `--- deployed
++++ local
+@@ -1,3 +1,3 @@
+ Resources:
+   A:
+-    Type: AWS::SNS::Topic
++    Type: AWS::SQS::Queue
+`, d)
+}
@@ -0,0 +1,315 @@
+package cfn
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/liangrog/cfctl/pkg/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// Parameter types
+const (
+	PARAM_TYPE_STRING    = "String"
+	PARAM_TYPE_NUMBER    = "Number"
+	PARAM_TYPE_LIST      = "CommaDelimitedList"
+	PARAM_TYPE_LIST_OF   = "List<%s>"
+	PARAM_TYPE_SSM_VALUE = "AWS::SSM::Parameter::Value<"
+)
+
+// Value formats of AWS-specific parameter types
+var awsParamFormats = map[string]*regexp.Regexp{
+	"AWS::EC2::AvailabilityZone::Name": regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d[a-z]*(-[a-z0-9]+)*$`),
+	"AWS::EC2::Image::Id":              regexp.MustCompile(`^ami-[0-9a-f]+$`),
+	"AWS::EC2::Instance::Id":           regexp.MustCompile(`^i-[0-9a-f]+$`),
+	"AWS::EC2::SecurityGroup::Id":      regexp.MustCompile(`^sg-[0-9a-f]+$`),
+	"AWS::EC2::Subnet::Id":             regexp.MustCompile(`^subnet-[0-9a-f]+$`),
+	"AWS::EC2::Volume::Id":             regexp.MustCompile(`^vol-[0-9a-f]+$`),
+	"AWS::EC2::VPC::Id":                regexp.MustCompile(`^vpc-[0-9a-f]+$`),
+	"AWS::Route53::HostedZone::Id":     regexp.MustCompile(`^Z[0-9A-Z]+$`),
+}
+
+// Decimal number. Hex, Inf and NaN accepted by
+// strconv.ParseFloat aren't numbers to CloudFormation.
+var decimalNumber = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+// Template parameter
+type Parameter struct {
+	Name                  string
+	Type                  string
+	Default               *string
+	AllowedValues         []string
+	AllowedPattern        string
+	MinLength             *int
+	MaxLength             *int
+	MinValue              *float64
+	MaxValue              *float64
+	ConstraintDescription string
+
+	// Line in the template
+	Line int
+
+	pattern *regexp.Regexp
+}
+
+// Parameter definition as in the template. Numeric
+// constraints can be quoted, e.g. "MinValue": "1".
+type parameterDef struct {
+	Type                  string   `yaml:"Type"`
+	Default               *string  `yaml:"Default"`
+	AllowedValues         []string `yaml:"AllowedValues"`
+	AllowedPattern        string   `yaml:"AllowedPattern"`
+	MinLength             *string  `yaml:"MinLength"`
+	MaxLength             *string  `yaml:"MaxLength"`
+	MinValue              *string  `yaml:"MinValue"`
+	MaxValue              *string  `yaml:"MaxValue"`
+	ConstraintDescription string   `yaml:"ConstraintDescription"`
+}
+
+// Create a parameter from its name and definition nodes
+func newParameter(key, n *yaml.Node) (*Parameter, error) {
+	name := key.Value
+
+	var def parameterDef
+	if err := n.Decode(&def); err != nil {
+		return nil, errors.New(fmt.Sprintf("line %d: Invalid parameter %s: %s", n.Line, name, err))
+	}
+
+	p := &Parameter{
+		Name:                  name,
+		Type:                  def.Type,
+		Default:               def.Default,
+		AllowedValues:         def.AllowedValues,
+		AllowedPattern:        def.AllowedPattern,
+		ConstraintDescription: def.ConstraintDescription,
+		Line:                  key.Line,
+	}
+
+	invalid := func(field string, err error) error {
+		return errors.New(fmt.Sprintf("line %d: Invalid %s of parameter %s: %s", n.Line, field, name, err))
+	}
+
+	var err error
+	if p.MinLength, err = parseInt(def.MinLength); err != nil {
+		return nil, invalid("MinLength", err)
+	}
+
+	if p.MaxLength, err = parseInt(def.MaxLength); err != nil {
+		return nil, invalid("MaxLength", err)
+	}
+
+	if p.MinValue, err = parseFloat(def.MinValue); err != nil {
+		return nil, invalid("MinValue", err)
+	}
+
+	if p.MaxValue, err = parseFloat(def.MaxValue); err != nil {
+		return nil, invalid("MaxValue", err)
+	}
+
+	if len(p.AllowedPattern) > 0 {
+		re, err := regexp.Compile("^(?:" + p.AllowedPattern + ")$")
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("line %d: Invalid AllowedPattern of parameter %s: %s", n.Line, name, err))
+		}
+
+		p.pattern = re
+	}
+
+	return p, nil
+}
+
+// Parse an optional integer constraint
+func parseInt(s *string) (*int, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	i, err := strconv.Atoi(strings.TrimSpace(*s))
+	if err != nil {
+		return nil, err
+	}
+
+	return &i, nil
+}
+
+// Parse an optional number constraint
+func parseFloat(s *string) (*float64, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	f, err := parseNumber(strings.TrimSpace(*s))
+	if err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+// Parse a decimal number. Values out of float64
+// range are rejected by strconv.ParseFloat.
+func parseNumber(s string) (float64, error) {
+	if !decimalNumber.MatchString(s) {
+		return 0, errors.New(fmt.Sprintf("'%s' isn't a decimal number", s))
+	}
+
+	return strconv.ParseFloat(s, 64)
+}
+
+// If the parameter must be given, i.e. it has no default
+func (p *Parameter) IsRequired() bool {
+	return p.Default == nil
+}
+
+// Return the element type if it's a list type,
+// e.g. "Number" for "List<Number>".
+func (p *Parameter) elemType() (string, bool) {
+	if p.Type == PARAM_TYPE_LIST {
+		return PARAM_TYPE_STRING, true
+	}
+
+	if strings.HasPrefix(p.Type, "List<") && strings.HasSuffix(p.Type, ">") {
+		return p.Type[len("List<") : len(p.Type)-1], true
+	}
+
+	return p.Type, false
+}
+
+// Validate a value of the parameter. All problems are returned.
+func (p *Parameter) Validate(value string) []string {
+	// Values of SSM parameter types are parameter names
+	if strings.HasPrefix(p.Type, PARAM_TYPE_SSM_VALUE) {
+		return nil
+	}
+
+	elemType, isList := p.elemType()
+	if !isList {
+		return p.validateValue(p.Type, value)
+	}
+
+	var msgs []string
+	for _, v := range strings.Split(value, ",") {
+		for _, msg := range p.validateValue(elemType, strings.TrimSpace(v)) {
+			msgs = append(msgs, fmt.Sprintf("item %s", msg))
+		}
+	}
+
+	return msgs
+}
+
+// Validate a single value of given type
+func (p *Parameter) validateValue(typ, value string) []string {
+	var msgs []string
+
+	if len(p.AllowedValues) > 0 && !utils.InSlice(p.AllowedValues, value) {
+		msgs = append(msgs, fmt.Sprintf("'%s' isn't one of allowed values: %s", value, strings.Join(p.AllowedValues, ", ")))
+	}
+
+	switch typ {
+	case PARAM_TYPE_STRING:
+		if p.pattern != nil && !p.pattern.MatchString(value) {
+			msgs = append(msgs, p.constraint(fmt.Sprintf("'%s' doesn't match pattern %s", value, p.AllowedPattern)))
+		}
+
+		if p.MinLength != nil && utf8.RuneCountInString(value) < *p.MinLength {
+			msgs = append(msgs, p.constraint(fmt.Sprintf("'%s' is shorter than %d", value, *p.MinLength)))
+		}
+
+		if p.MaxLength != nil && utf8.RuneCountInString(value) > *p.MaxLength {
+			msgs = append(msgs, p.constraint(fmt.Sprintf("'%s' is longer than %d", value, *p.MaxLength)))
+		}
+	case PARAM_TYPE_NUMBER:
+		n, err := parseNumber(value)
+		if err != nil {
+			return append(msgs, fmt.Sprintf("'%s' isn't a number", value))
+		}
+
+		if p.MinValue != nil && n < *p.MinValue {
+			msgs = append(msgs, p.constraint(fmt.Sprintf("%s is less than %s", value, formatNumber(*p.MinValue))))
+		}
+
+		if p.MaxValue != nil && n > *p.MaxValue {
+			msgs = append(msgs, p.constraint(fmt.Sprintf("%s is greater than %s", value, formatNumber(*p.MaxValue))))
+		}
+	default:
+		// Empty values are left to CloudFormation
+		if re, ok := awsParamFormats[typ]; ok && len(value) > 0 && !re.MatchString(value) {
+			msgs = append(msgs, fmt.Sprintf("'%s' isn't a valid %s", value, typ))
+		}
+	}
+
+	return msgs
+}
+
+// Add constraint description to the message if any
+func (p *Parameter) constraint(msg string) string {
+	if len(p.ConstraintDescription) > 0 {
+		return fmt.Sprintf("%s (%s)", msg, p.ConstraintDescription)
+	}
+
+	return msg
+}
+
+// Parameter error
+type ParamError struct {
+	Parameter string `json:"parameter" yaml:"parameter"`
+	Message   string `json:"message" yaml:"message"`
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("Parameter %s %s", e.Parameter, e.Message)
+}
+
+// Validate parameters against the template. Parameters in
+// usePrevious aren't given but keep their current values.
+// All errors are returned, sorted by parameter name.
+func (t *Template) ValidateParams(params map[string]string, usePrevious []string) []*ParamError {
+	var errs []*ParamError
+
+	for k := range params {
+		if t.Parameter(k) == nil {
+			errs = append(errs, &ParamError{k, "isn't defined in the template"})
+		}
+	}
+
+	for _, k := range usePrevious {
+		if t.Parameter(k) == nil {
+			errs = append(errs, &ParamError{k, "isn't defined in the template"})
+		}
+	}
+
+	for _, p := range t.Parameters {
+		if utils.InSlice(usePrevious, p.Name) {
+			continue
+		}
+
+		v, ok := params[p.Name]
+		if !ok {
+			if p.IsRequired() {
+				errs = append(errs, &ParamError{p.Name, "is required but not given"})
+			}
+
+			continue
+		}
+
+		for _, msg := range p.Validate(v) {
+			errs = append(errs, &ParamError{p.Name, msg})
+		}
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Parameter < errs[j].Parameter
+	})
+
+	return errs
+}
+
+// Format a number without trailing zeros
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
@@ -0,0 +1,99 @@
+package cfn
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Template sections
+const (
+	SECTION_PARAMETERS = "Parameters"
+	SECTION_CONDITIONS = "Conditions"
+	SECTION_RESOURCES  = "Resources"
+	SECTION_OUTPUTS    = "Outputs"
+)
+
+// CloudFormation template parsed locally. Both JSON and YAML with
+// short form intrinsic functions such as "!Ref" are supported.
+type Template struct {
+	// Parameters in the order of the template
+	Parameters []*Parameter
+
+	// Root node of the template
+	root *yaml.Node
+}
+
+// Parse a template
+func Parse(dat []byte) (*Template, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(dat, &doc); err != nil {
+		return nil, err
+	}
+
+	t := new(Template)
+	if len(doc.Content) == 0 {
+		return t, nil
+	}
+
+	t.root = doc.Content[0]
+	if t.root.Kind != yaml.MappingNode {
+		return nil, errors.New("Template must be a map")
+	}
+
+	params := t.Section(SECTION_PARAMETERS)
+	if params == nil {
+		return t, nil
+	}
+
+	if params.Kind != yaml.MappingNode {
+		return nil, errors.New(fmt.Sprintf("line %d: Parameters must be a map", params.Line))
+	}
+
+	for i := 0; i+1 < len(params.Content); i += 2 {
+		p, err := newParameter(params.Content[i], params.Content[i+1])
+		if err != nil {
+			return nil, err
+		}
+
+		t.Parameters = append(t.Parameters, p)
+	}
+
+	return t, nil
+}
+
+// Return a top level section of the template
+func (t *Template) Section(name string) *yaml.Node {
+	if t.root == nil {
+		return nil
+	}
+
+	return mapValue(t.root, name)
+}
+
+// Return a parameter by its name
+func (t *Template) Parameter(name string) *Parameter {
+	for _, p := range t.Parameters {
+		if p.Name == name {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// Return the value of a key in a map node
+func mapValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+
+	return nil
+}
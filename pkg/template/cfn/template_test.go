@@ -0,0 +1,166 @@
+package cfn
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testTemplate = `
+AWSTemplateFormatVersion: "2010-09-09"
+Parameters:
+  Env:
+    Type: String
+    AllowedValues: [dev, prod]
+  Name:
+    Type: String
+    AllowedPattern: "[a-z]+"
+    MinLength: 3
+    MaxLength: 8
+    ConstraintDescription: lower case letters only
+  Size:
+    Type: Number
+    Default: 2
+    MinValue: 1
+    MaxValue: 10
+  Ports:
+    Type: List<Number>
+    Default: "80"
+  Zones:
+    Type: CommaDelimitedList
+    Default: a
+    AllowedValues: [a, b, c]
+  VpcId:
+    Type: AWS::EC2::VPC::Id
+  Subnets:
+    Type: List<AWS::EC2::Subnet::Id>
+    Default: ""
+  Ami:
+    Type: AWS::SSM::Parameter::Value<AWS::EC2::Image::Id>
+    Default: /aws/service/ami
+Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+    Properties:
+      BucketName: !Sub "${Name}-bucket"
+`
+
+func TestParse(t *testing.T) {
+	tpl, err := Parse([]byte(testTemplate))
+	assert.NoError(t, err)
+	assert.Equal(t, 8, len(tpl.Parameters))
+	assert.Equal(t, "Env", tpl.Parameters[0].Name)
+	assert.True(t, tpl.Parameter("Env").IsRequired())
+	assert.False(t, tpl.Parameter("Size").IsRequired())
+	assert.Equal(t, "2", *tpl.Parameter("Size").Default)
+	assert.Equal(t, 4, tpl.Parameter("Env").Line)
+	assert.NotNil(t, tpl.Section(SECTION_RESOURCES))
+
+	// JSON
+	tpl, err = Parse([]byte(`{"Parameters": {"Env": {"Type": "String", "AllowedValues": ["dev"]}}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dev"}, tpl.Parameter("Env").AllowedValues)
+
+	_, err = Parse([]byte(`Parameters: [a]`))
+	assert.Error(t, err)
+
+	// Quoted numeric constraints
+	tpl, err = Parse([]byte(`{"Parameters": {"Size": {"Type": "Number", "MinValue": "1", "MaxValue": "1.5"}, "Name": {"Type": "String", "MinLength": "2", "MaxLength": " 4"}}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, *tpl.Parameter("Size").MinValue)
+	assert.Equal(t, 1.5, *tpl.Parameter("Size").MaxValue)
+	assert.Equal(t, 2, *tpl.Parameter("Name").MinLength)
+	assert.Equal(t, 4, *tpl.Parameter("Name").MaxLength)
+	assert.Empty(t, Lint("t.json", []byte(`{"Parameters": {"Size": {"Type": "Number", "MinValue": "1"}}, "Resources": {"Topic": {"Type": "AWS::SNS::Topic", "Properties": {"DisplayName": {"Ref": "Size"}}}}}`)))
+
+	_, err = Parse([]byte("Parameters:\n  Size:\n    Type: Number\n    MinValue: one\n"))
+	assert.Error(t, err)
+
+	// Only decimal numbers
+	for _, v := range []string{"NaN", "Inf", "0x1p4", "1e999", "1_000"} {
+		_, err = Parse([]byte(fmt.Sprintf("Parameters:\n  Size:\n    Type: Number\n    MaxValue: \"%s\"\n", v)))
+		assert.Error(t, err, v)
+	}
+
+	_, err = Parse([]byte("Parameters:\n  Name:\n    Type: String\n    AllowedPattern: \"[a-\"\n"))
+	assert.Error(t, err)
+}
+
+func TestValidateParams(t *testing.T) {
+	tpl, err := Parse([]byte(testTemplate))
+	assert.NoError(t, err)
+
+	errs := tpl.ValidateParams(map[string]string{
+		"Env":     "prod",
+		"Name":    "web",
+		"VpcId":   "vpc-0a1b2c",
+		"Size":    "10",
+		"Ports":   "80, 443",
+		"Zones":   "a,c",
+		"Subnets": "subnet-1a,subnet-2b",
+		"Ami":     "/my/ami",
+	}, nil)
+	assert.Empty(t, errs)
+
+	errs = tpl.ValidateParams(map[string]string{
+		"Env":     "test",
+		"Name":    "Web-Server",
+		"Size":    "11",
+		"Ports":   "80,http",
+		"Zones":   "d",
+		"VpcId":   "vpc1",
+		"Subnets": "subnet-1a,sn-2",
+		"Unknown": "x",
+	}, []string{"Previous"})
+
+	var msgs []string
+	for _, e := range errs {
+		msgs = append(msgs, e.Error())
+	}
+
+	assert.Equal(t, []string{
+		"Parameter Env 'test' isn't one of allowed values: dev, prod",
+		"Parameter Name 'Web-Server' doesn't match pattern [a-z]+ (lower case letters only)",
+		"Parameter Name 'Web-Server' is longer than 8 (lower case letters only)",
+		"Parameter Ports item 'http' isn't a number",
+		"Parameter Previous isn't defined in the template",
+		"Parameter Size 11 is greater than 10",
+		"Parameter Subnets item 'sn-2' isn't a valid AWS::EC2::Subnet::Id",
+		"Parameter Unknown isn't defined in the template",
+		"Parameter VpcId 'vpc1' isn't a valid AWS::EC2::VPC::Id",
+		"Parameter Zones item 'd' isn't one of allowed values: a, b, c",
+	}, msgs)
+
+	// Missing required and using previous value
+	errs = tpl.ValidateParams(map[string]string{"Name": "ab"}, []string{"VpcId"})
+	msgs = nil
+	for _, e := range errs {
+		msgs = append(msgs, e.Error())
+	}
+
+	assert.Equal(t, []string{
+		"Parameter Env is required but not given",
+		"Parameter Name 'ab' is shorter than 3 (lower case letters only)",
+	}, msgs)
+
+	// Lengths are in characters
+	tpl, err = Parse([]byte("Parameters:\n  Name:\n    Type: String\n    MaxLength: 3\n  Zone:\n    Type: AWS::EC2::AvailabilityZone::Name\n"))
+	assert.NoError(t, err)
+	assert.Empty(t, tpl.ValidateParams(map[string]string{"Name": "äöü", "Zone": "us-west-2-lax-1a"}, nil))
+	assert.Empty(t, tpl.ValidateParams(map[string]string{"Name": "abc", "Zone": "us-east-1-wl1-bos-wlz-1"}, nil))
+	assert.Empty(t, tpl.ValidateParams(map[string]string{"Name": "abc", "Zone": "ap-southeast-2a"}, nil))
+	assert.Equal(t, 2, len(tpl.ValidateParams(map[string]string{"Name": "abcd", "Zone": "us-east"}, nil)))
+
+	// Numbers accepted by Go but not by CloudFormation
+	tpl, err = Parse([]byte("Parameters:\n  Size:\n    Type: Number\n    MinValue: 1\n"))
+	assert.NoError(t, err)
+	assert.Empty(t, tpl.ValidateParams(map[string]string{"Size": "1.5e2"}, nil))
+	assert.Empty(t, tpl.ValidateParams(map[string]string{"Size": ".5e1"}, nil))
+	for _, v := range []string{"NaN", "+Inf", "infinity", "0x10", "1e999"} {
+		errs := tpl.ValidateParams(map[string]string{"Size": v}, nil)
+		if assert.Equal(t, 1, len(errs), v) {
+			assert.EqualError(t, errs[0], fmt.Sprintf("Parameter Size '%s' isn't a number", v))
+		}
+	}
+}
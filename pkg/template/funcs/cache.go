@@ -0,0 +1,75 @@
+package funcs
+
+import (
+	"sync"
+
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// Stack outputs cache shared by all parameter
+// rendering during a single cfctl run.
+var stackOutputCache = newOutputCache()
+
+// Cache key for stack outputs
+type outputCacheKey struct {
+	profile string
+	region  string
+	stack   string
+}
+
+// Run-scoped stack outputs cache. It saves calling
+// DescribeStacks for every stackOutput evaluation.
+type outputCache struct {
+	lock  sync.Mutex
+	items map[outputCacheKey][]*cf.Output
+}
+
+// Output cache constructor
+func newOutputCache() *outputCache {
+	return &outputCache{items: make(map[outputCacheKey][]*cf.Output)}
+}
+
+// Return the cached outputs for given key. If not cached,
+// the outputs will be fetched and stored. The lock is only
+// held around the map access so lookups of different
+// stacks aren't serialised by the fetching.
+func (c *outputCache) get(key outputCacheKey, fetch func() ([]*cf.Output, error)) ([]*cf.Output, error) {
+	c.lock.Lock()
+	outputs, ok := c.items[key]
+	c.lock.Unlock()
+
+	if ok {
+		return outputs, nil
+	}
+
+	outputs, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	c.items[key] = outputs
+	c.lock.Unlock()
+
+	return outputs, nil
+}
+
+// Remove the cached outputs for given stack
+// from all profiles and regions.
+func (c *outputCache) invalidate(stack string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for k := range c.items {
+		if k.stack == stack {
+			delete(c.items, k)
+		}
+	}
+}
+
+// Invalidate cached outputs of given stack. It should be
+// called once a stack has been created or updated so
+// the downstream stacks can see the fresh outputs.
+func InvalidateStackOutputs(stack string) {
+	stackOutputCache.invalidate(stack)
+}
@@ -0,0 +1,65 @@
+package funcs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputCache(t *testing.T) {
+	c := newOutputCache()
+
+	var calls int
+	fetch := func() ([]*cf.Output, error) {
+		calls++
+		return []*cf.Output{
+			new(cf.Output).SetOutputKey("VpcId").SetOutputValue("vpc-123"),
+		}, nil
+	}
+
+	key := outputCacheKey{region: "ap-southeast-2", stack: "vpc"}
+
+	// Only fetch once for the same key
+	for i := 0; i < 3; i++ {
+		out, err := c.get(key, fetch)
+		assert.NoError(t, err)
+		assert.Equal(t, "vpc-123", aws.StringValue(out[0].OutputValue))
+	}
+	assert.Equal(t, 1, calls)
+
+	// Different profile is cached separately
+	_, err := c.get(outputCacheKey{profile: "cross", stack: "vpc"}, fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	// Invalidate all cached outputs of the stack
+	c.invalidate("vpc")
+	_, err = c.get(key, fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	// Errors are not cached
+	_, err = c.get(outputCacheKey{stack: "missing"}, func() ([]*cf.Output, error) {
+		return nil, errors.New("not found")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 0, len(c.items[outputCacheKey{stack: "missing"}]))
+
+	// Fetching doesn't block lookups of other stacks
+	fetching := make(chan bool)
+	release := make(chan bool)
+	go c.get(outputCacheKey{stack: "slow"}, func() ([]*cf.Output, error) {
+		fetching <- true
+		<-release
+		return nil, nil
+	})
+
+	<-fetching
+	out, err := c.get(key, fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, "vpc-123", aws.StringValue(out[0].OutputValue))
+	close(release)
+}
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"text/template"
 
+	"github.com/aws/aws-sdk-go/aws"
 	cf "github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/sts"
 	ctlaws "github.com/liangrog/cfctl/pkg/aws"
@@ -18,6 +20,16 @@ const (
 	FUNC_NAME_HASH           = "hash"
 )
 
+// Functions available to environment values. Functions
+// depending on a stack, e.g. stackOutput, aren't included.
+func ValueFuncMap() template.FuncMap {
+	return template.FuncMap{
+		FUNC_NAME_ENV:            GetEnv,
+		FUNC_NAME_AWS_ACCOUNT_ID: AwsAccountId,
+		FUNC_NAME_HASH:           Md5,
+	}
+}
+
 // Returns empty string
 func EmptyStr(s string) string {
 	return ""
@@ -59,17 +71,33 @@ func GetStackOutputs(params ...string) (string, error) {
 	name := params[0]
 	key := params[1]
 
-	c := ctlaws.NewStack(cf.New(ctlaws.AWSSess))
+	// The region of a profile is given by the profile
+	// so the session is only created when fetching.
+	cacheKey := outputCacheKey{stack: name}
 	if len(params) == 3 {
-		c = ctlaws.NewStack(cf.New(ctlaws.GetSessionWithProfile(params[2])))
+		cacheKey.profile = params[2]
+	} else {
+		cacheKey.region = aws.StringValue(ctlaws.AWSSess.Config.Region)
 	}
 
-	stack, err := c.DescribeStack(name)
+	outputs, err := stackOutputCache.get(cacheKey, func() ([]*cf.Output, error) {
+		sess := ctlaws.AWSSess
+		if len(cacheKey.profile) > 0 {
+			sess = ctlaws.GetSessionWithProfile(cacheKey.profile)
+		}
+
+		stack, err := ctlaws.NewStack(cf.New(sess)).DescribeStack(name)
+		if err != nil {
+			return nil, err
+		}
+
+		return stack.Outputs, nil
+	})
 	if err != nil {
 		return "", err
 	}
 
-	for _, out := range stack.Outputs {
+	for _, out := range outputs {
 		// Check both key and export name
 		if *out.OutputKey == key || (out.ExportName != nil && *out.ExportName == key) {
 			fmt.Printf(
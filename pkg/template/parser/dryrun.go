@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	ctlaws "github.com/liangrog/cfctl/pkg/aws"
+	"github.com/liangrog/cfctl/pkg/conf"
+	"github.com/liangrog/cfctl/pkg/template/funcs"
+)
+
+// Value of a stack output not known until the stack is deployed
+const DRY_RUN_OUTPUT = "<%s.%s known after deploy>"
+
+// Simulation of the functions with side effect for dry run.
+// Templates of "tpl" are rendered but not uploaded, and stack
+// outputs are only looked up.
+type DryRun struct {
+	// Stacks existing in the account
+	Existing map[string]bool
+
+	// Stacks deployed earlier in the same run. Their outputs
+	// may not exist yet.
+	Deployed map[string]bool
+
+	// Templates rendered by "tpl" keyed by path
+	Templates map[string][]byte
+
+	// Don't look up any stack output and don't print, e.g.
+	// for rendering locally. All outputs are placeholders.
+	Offline bool
+
+	// Values of outputs not known yet
+	placeholders []string
+}
+
+// Enabled dry run, nil if not enabled
+var dryRun *DryRun
+
+// Dry run constructor
+func NewDryRun(existing []string) *DryRun {
+	d := &DryRun{
+		Existing:  make(map[string]bool),
+		Deployed:  make(map[string]bool),
+		Templates: make(map[string][]byte),
+	}
+
+	for _, s := range existing {
+		d.Existing[s] = true
+	}
+
+	return d
+}
+
+// Enable dry run for all parsing afterwards.
+// Giving nil disables it.
+func EnableDryRun(d *DryRun) {
+	dryRun = d
+}
+
+// If the value contains output not known yet
+func (d *DryRun) IsUnknown(v string) bool {
+	for _, p := range d.placeholders {
+		if strings.Contains(v, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Render a template of "tpl" and return its S3 URL
+// without uploading it
+func (d *DryRun) s3URL(render bool, kv map[string]interface{}, dc *conf.DeployConfig) func(string) (string, error) {
+	return func(path string) (string, error) {
+		content, err := LoadTemplate(path, isTemplatedNested(render, path), kv, dc)
+		if err != nil {
+			return "", err
+		}
+
+		d.Templates[path] = content
+
+		url, err := ctlaws.S3Url(dc.S3Bucket, dc.GetTplPath(path))
+		if err != nil || d.Offline {
+			return url, err
+		}
+
+		fmt.Printf(
+			"[ s3 | upload ] template: %s\tURL: %s\t(dry run)\n",
+			path,
+			url,
+		)
+
+		return url, nil
+	}
+}
+
+// Look up a stack output. Outputs of the stacks deployed
+// earlier in the run are placeholders if not existing yet.
+func (d *DryRun) stackOutput(params ...string) (string, error) {
+	if d.Offline && len(params) >= 2 {
+		return d.placeholder(params[0], params[1]), nil
+	}
+
+	if len(params) != 2 {
+		return funcs.GetStackOutputs(params...)
+	}
+
+	name, key := params[0], params[1]
+
+	if !d.Existing[name] && !d.Deployed[name] {
+		return "", errors.New(fmt.Sprintf("Stack %s doesn't exist and isn't deployed earlier in this run.", name))
+	}
+
+	if d.Existing[name] {
+		out, err := funcs.GetStackOutputs(params...)
+		if err == nil || !d.Deployed[name] {
+			return out, err
+		}
+	}
+
+	// The output may be added by the deployment
+	p := d.placeholder(name, key)
+
+	fmt.Printf(
+		"[ stack | stack-output ] name: %s\tkey: %s\tvalue: %s\n",
+		name,
+		key,
+		p,
+	)
+
+	return p, nil
+}
+
+// Return the placeholder of a stack output
+func (d *DryRun) placeholder(name, key string) string {
+	p := fmt.Sprintf(DRY_RUN_OUTPUT, name, key)
+	d.placeholders = append(d.placeholders, p)
+
+	return p
+}
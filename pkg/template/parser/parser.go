@@ -18,10 +18,16 @@ const (
 )
 
 // Parse template by given function map and key values
-func parse(s string, funcMap template.FuncMap, kv map[string]string) (bytes.Buffer, error) {
+func parse(s string, funcMap template.FuncMap, kv map[string]interface{}) (bytes.Buffer, error) {
+	return parseDelims(s, "", "", funcMap, kv)
+}
+
+// Parse template with given action delimiters. Empty
+// delimiters default to "{{" and "}}".
+func parseDelims(s, left, right string, funcMap template.FuncMap, kv map[string]interface{}) (bytes.Buffer, error) {
 	var b bytes.Buffer
 
-	tmpl, err := template.New(uuid.New().String()).Funcs(funcMap).Parse(s)
+	tmpl, err := template.New(uuid.New().String()).Delims(left, right).Funcs(funcMap).Parse(s)
 	if err != nil {
 		return b, err
 	}
@@ -35,7 +41,7 @@ func parse(s string, funcMap template.FuncMap, kv map[string]string) (bytes.Buff
 
 // Parsing template twice giving its ability to
 // allow using function as value.
-func doubleParse(s string, funcMap template.FuncMap, kv map[string]string) (bytes.Buffer, error) {
+func doubleParse(s string, funcMap template.FuncMap, kv map[string]interface{}) (bytes.Buffer, error) {
 	b, err := parse(s, funcMap, kv)
 	if err != nil {
 		return b, err
@@ -51,24 +57,40 @@ func doubleParse(s string, funcMap template.FuncMap, kv map[string]string) (byte
 	return b, nil
 }
 
+// Function map without side effect for scanning
+// templates. All functions return empty string.
+func ScanFuncMap() template.FuncMap {
+	return template.FuncMap{
+		funcs.FUNC_NAME_STACK_OUTPUT:   func(params ...string) string { return "" },
+		FUNC_S3URL:                     funcs.EmptyStr,
+		funcs.FUNC_NAME_ENV:            funcs.EmptyStr,
+		funcs.FUNC_NAME_AWS_ACCOUNT_ID: funcs.EmptyInput,
+		funcs.FUNC_NAME_HASH:           funcs.EmptyStr,
+	}
+}
+
 // Search template if it has dependency on other stacks
-func SearchDependancy(s string, kv map[string]string) ([]string, error) {
+func SearchDependancy(s string, kv map[string]interface{}) ([]string, error) {
+	return searchDependancy(s, "", "", kv)
+}
+
+// Search dependency on other stacks in a stack setting
+// rendered with "[[ ]]" delimiters, e.g. inline parameters.
+func SearchDeferredDependancy(s string, kv map[string]interface{}) ([]string, error) {
+	return searchDependancy(s, conf.DEFERRED_LEFT_DELIM, conf.DEFERRED_RIGHT_DELIM, kv)
+}
+
+// Search dependency with given delimiters
+func searchDependancy(s, left, right string, kv map[string]interface{}) ([]string, error) {
 	var p []string
 
-	funcParentStack := func(params ...string) string {
+	funcMap := ScanFuncMap()
+	funcMap[funcs.FUNC_NAME_STACK_OUTPUT] = func(params ...string) string {
 		p = append(p, params[0])
 		return ""
 	}
 
-	funcMap := template.FuncMap{
-		funcs.FUNC_NAME_STACK_OUTPUT:   funcParentStack,
-		FUNC_S3URL:                     funcs.EmptyStr,
-		funcs.FUNC_NAME_ENV:            funcs.EmptyStr,
-		funcs.FUNC_NAME_AWS_ACCOUNT_ID: funcs.EmptyInput,
-		funcs.FUNC_NAME_HASH:           funcs.EmptyStr,
-	}
-
-	if _, err := parse(s, funcMap, kv); err != nil {
+	if _, err := parseDelims(s, left, right, funcMap, kv); err != nil {
 		return nil, err
 	}
 
@@ -76,13 +98,36 @@ func SearchDependancy(s string, kv map[string]string) ([]string, error) {
 }
 
 // Parse template with given key-value pairs, environment variables,
-// s3 template URL and stack outputs.
-func Parse(s string, kv map[string]string, dc *conf.DeployConfig) ([]byte, error) {
+// s3 template URL and stack outputs. If render is true, the nested
+// templates of "tpl" are rendered as the stack template is.
+func Parse(s string, render bool, kv map[string]interface{}, dc *conf.DeployConfig) ([]byte, error) {
+	output, err := parse(s, paramFuncMap(render, kv, dc), kv)
+
+	return output.Bytes(), err
+}
+
+// Parse a stack setting rendered with "[[ ]]" delimiters, e.g.
+// inline parameters, with the same functions as Parse.
+func ParseDeferred(s string, render bool, kv map[string]interface{}, dc *conf.DeployConfig) ([]byte, error) {
+	output, err := parseDelims(s, conf.DEFERRED_LEFT_DELIM, conf.DEFERRED_RIGHT_DELIM, paramFuncMap(render, kv, dc), kv)
+
+	return output.Bytes(), err
+}
+
+// If a nested template of "tpl" needs rendering. It inherits
+// the render setting of the stack, otherwise it's rendered
+// by its suffix.
+func isTemplatedNested(render bool, path string) bool {
+	return render || conf.IsTemplatedFile(path)
+}
+
+// Function map of parameter files and templates
+func paramFuncMap(render bool, kv map[string]interface{}, dc *conf.DeployConfig) template.FuncMap {
 	// Convert a give templat
 	// file path to s3 url
 	cfs3 := ctlaws.NewS3(s3.New(ctlaws.AWSSess))
 	funcS3URL := func(path string) (string, error) {
-		content, err := ioutil.ReadFile(dc.GetTplPath(path))
+		content, err := LoadTemplate(path, isTemplatedNested(render, path), kv, dc)
 		if err != nil {
 			return "", err
 		}
@@ -110,7 +155,27 @@ func Parse(s string, kv map[string]string, dc *conf.DeployConfig) ([]byte, error
 		funcs.FUNC_NAME_HASH:           funcs.Md5,
 	}
 
-	output, err := parse(s, funcMap, kv)
+	if dryRun != nil {
+		funcMap[FUNC_S3URL] = dryRun.s3URL(render, kv, dc)
+		funcMap[funcs.FUNC_NAME_STACK_OUTPUT] = dryRun.stackOutput
+	}
 
-	return output.Bytes(), err
+	return funcMap
+}
+
+// Load cloudformation template from template directory. If render
+// is true, the template will be parsed with given key-value pairs
+// and the same functions as the parameter files, and so are its
+// nested templates.
+func LoadTemplate(name string, render bool, kv map[string]interface{}, dc *conf.DeployConfig) ([]byte, error) {
+	content, err := ioutil.ReadFile(dc.GetTplPath(name))
+	if err != nil {
+		return nil, err
+	}
+
+	if !render {
+		return content, nil
+	}
+
+	return Parse(string(content), render, kv, dc)
 }
@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/liangrog/cfctl/pkg/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNestedTemplateRender(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "parser")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string]string{
+		"stacks.yaml":           "s3Bucket: test\ntemplateDir: templates\n",
+		"templates/parent.yaml": `Url: {{ tpl "child.yaml" }}`,
+		"templates/child.yaml":  `Name: {{ .name }}`,
+		"templates/child.tmpl":  `Name: {{ .name }}`,
+	}
+
+	for name, content := range files {
+		p := filepath.Join(tmpDir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), os.ModePerm))
+		assert.NoError(t, ioutil.WriteFile(p, []byte(content), 0644))
+	}
+
+	dc, err := conf.NewDeployConfig(filepath.Join(tmpDir, "stacks.yaml"))
+	assert.NoError(t, err)
+
+	dr := NewDryRun(nil)
+	EnableDryRun(dr)
+	defer EnableDryRun(nil)
+
+	kv := map[string]interface{}{"name": "app"}
+
+	// Nested templates of a rendered template are rendered
+	out, err := LoadTemplate("parent.yaml", true, kv, dc)
+	assert.NoError(t, err)
+	assert.Regexp(t, `^Url: https://test\.s3\.amazonaws\.com/.*/templates/child\.yaml$`, string(out))
+	assert.Equal(t, "Name: app", string(dr.Templates["child.yaml"]))
+
+	// So are the ones of parameter files of a rendered stack
+	delete(dr.Templates, "child.yaml")
+	_, err = Parse(`Url: {{ tpl "child.yaml" }}`, true, kv, dc)
+	assert.NoError(t, err)
+	assert.Equal(t, "Name: app", string(dr.Templates["child.yaml"]))
+
+	// Otherwise only the ones with ".tmpl" suffix
+	_, err = Parse(`Url: {{ tpl "child.yaml" }}`, false, kv, dc)
+	assert.NoError(t, err)
+	assert.Equal(t, "Name: {{ .name }}", string(dr.Templates["child.yaml"]))
+
+	_, err = Parse(`Url: {{ tpl "child.tmpl" }}`, false, kv, dc)
+	assert.NoError(t, err)
+	assert.Equal(t, "Name: app", string(dr.Templates["child.tmpl"]))
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
 
 	"gopkg.in/yaml.v2"
 )
@@ -106,6 +107,13 @@ func StdoutWarn(s ...interface{}) error {
 	return err
 }
 
+// Print to stderr with warn header.
+func StderrWarn(s ...interface{}) error {
+	s = append([]interface{}{fmt.Sprintf("[ %s ] ", MessageTypeWarn)}, s...)
+	_, err := fmt.Fprint(os.Stderr, s...)
+	return err
+}
+
 // Print to stdout with error header.
 func StdoutError(s ...interface{}) error {
 	s = append([]interface{}{fmt.Sprintf("[ %s ] ", MessageTypeError)}, s...)
@@ -169,8 +169,9 @@ func ScanFiles(root string, exit <-chan bool, level int) (<-chan string, <-chan
 }
 
 // Yaml cleansing such as remove comment in yaml file.
+// The document can be either a map or a list.
 func GetCleanYamlBytes(input []byte) ([]byte, error) {
-	t := make(map[interface{}]interface{})
+	var t interface{}
 	if err := yaml.Unmarshal(input, &t); err != nil {
 		return nil, err
 	}